@@ -0,0 +1,48 @@
+package couchbase
+
+import (
+	"encoding/json"
+	"github.com/couchbase/gocb/v2"
+	"github.com/pkg/errors"
+)
+
+// couchbaseDocumentStore reads and writes raw JSON documents, it implements the kafka connector's
+// DocumentStore so a kafka source can checkpoint its offsets to a Couchbase document.
+type couchbaseDocumentStore struct {
+	sink *couchbaseSink
+}
+
+// NewCouchbaseDocumentStore connects to the bucket of the given config, only its connection
+// settings, Timeout, RetryTimeout and MaxRetries are used.
+func NewCouchbaseDocumentStore(config SinkConfig) *couchbaseDocumentStore {
+	return &couchbaseDocumentStore{sink: NewCouchbaseSink(config)}
+}
+
+// Get returns the JSON document with the given id, or nil if it doesn't exist.
+func (this *couchbaseDocumentStore) Get(id string) ([]byte, error) {
+	var out json.RawMessage
+	err := this.sink.executeWithRetries(func() error {
+		res, err := this.sink.bucket.DefaultCollection().Get(id, &gocb.GetOptions{Timeout: this.sink.config.Timeout})
+		if err != nil {
+			if errors.Is(err, gocb.ErrDocumentNotFound) {
+				out = nil
+				return nil
+			}
+			return err
+		}
+		return res.Content(&out)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Upsert creates or replaces the JSON document with the given id.
+func (this *couchbaseDocumentStore) Upsert(id string, doc []byte) error {
+	opts := &gocb.UpsertOptions{Timeout: this.sink.config.Timeout}
+	return this.sink.executeWithRetries(func() error {
+		_, err := this.sink.bucket.DefaultCollection().Upsert(id, json.RawMessage(doc), opts)
+		return err
+	})
+}
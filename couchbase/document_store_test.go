@@ -0,0 +1,19 @@
+package couchbase
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCouchbaseDocumentStore(t *testing.T) {
+	store := NewCouchbaseDocumentStore(testConfig)
+
+	doc, err := store.Get("document-store-missing")
+	assert.Nil(t, err)
+	assert.Nil(t, doc)
+
+	assert.Nil(t, store.Upsert("document-store-doc", []byte(`{"offsets":[{"topic":"t","partition":0,"offset":3}]}`)))
+	doc, err = store.Get("document-store-doc")
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"offsets":[{"topic":"t","partition":0,"offset":3}]}`, string(doc))
+}
@@ -0,0 +1,183 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	k "github.com/segmentio/kafka-go"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TopicSpec describes a topic that should exist on the cluster.
+type TopicSpec struct {
+	Topic string
+
+	// Default: 1
+	Partitions int
+
+	// Default: 1
+	ReplicationFactor int
+
+	// Config holds topic level configs, e.g. "retention.ms" or "cleanup.policy".
+	Config map[string]string
+}
+
+// GroupOffset describes the progress of a consumer group on a single partition.
+type GroupOffset struct {
+	// The committed offset of the group, -1 if the group didn't commit anything yet.
+	Committed int64
+
+	// The offset of the next message that will be produced to the partition.
+	End int64
+
+	// The number of messages the group didn't consume yet.
+	Lag int64
+}
+
+type kafkaAdmin struct {
+	hosts  []string
+	dialer *k.Dialer
+	client *k.Client
+}
+
+func NewKafkaAdmin(hosts []string, tlsConfig *TLSConfig, saslConfig *SASLConfig) *kafkaAdmin {
+	dialer, err := newDialer(tlsConfig, saslConfig)
+	if err != nil {
+		panic(err)
+	}
+	return newKafkaAdmin(hosts, dialer)
+}
+
+func newKafkaAdmin(hosts []string, dialer *k.Dialer) *kafkaAdmin {
+	return &kafkaAdmin{
+		hosts:  hosts,
+		dialer: dialer,
+		client: k.NewClientWith(k.ClientConfig{Brokers: hosts, Dialer: dialer}),
+	}
+}
+
+// EnsureTopic creates the topic if it doesn't exist yet, an existing topic is left as is
+// even if its partitions, replication factor or config are different.
+func (this *kafkaAdmin) EnsureTopic(spec TopicSpec) error {
+	if spec.Topic == "" {
+		return fmt.Errorf("can't create a kafka topic without a name")
+	}
+
+	conn, err := this.controller()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.CreateTopics(spec.topicConfig()); err != nil {
+		return fmt.Errorf("failed to create kafka topic '%s': %s", spec.Topic, err.Error())
+	}
+	return nil
+}
+
+// ListTopics returns the sorted names of all the topics on the cluster.
+func (this *kafkaAdmin) ListTopics() ([]string, error) {
+	conn, err := dialAny(this.dialer, this.hosts)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	partitions, err := conn.ReadPartitions()
+	if err != nil {
+		return nil, err
+	}
+
+	unique := make(map[string]bool)
+	for _, partition := range partitions {
+		unique[partition.Topic] = true
+	}
+	topics := make([]string, 0, len(unique))
+	for topic := range unique {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+// DescribeGroupOffsets returns the committed offset and the lag of the consumer group on every partition of the given topics.
+func (this *kafkaAdmin) DescribeGroupOffsets(group string, topics ...string) (map[TopicPartition]GroupOffset, error) {
+	out := make(map[TopicPartition]GroupOffset)
+	for _, topic := range topics {
+		ctx, cancel := context.WithTimeout(context.Background(), this.dialer.Timeout)
+		committed, err := this.client.ConsumerOffsets(ctx, k.TopicAndGroup{Topic: topic, GroupId: group})
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the offsets of group '%s' on topic '%s': %s", group, topic, err.Error())
+		}
+
+		for partition, offset := range committed {
+			tp := TopicPartition{Topic: topic, Partition: partition}
+			first, end, err := this.partitionOffsets(tp)
+			if err != nil {
+				return nil, err
+			}
+
+			// the client reports partitions without a committed offset as FirstOffset
+			described := GroupOffset{Committed: offset, End: end, Lag: end - offset}
+			if offset < 0 {
+				described.Committed = -1
+				described.Lag = end - first
+			}
+			out[tp] = described
+		}
+	}
+	return out, nil
+}
+
+// partitionOffsets returns the first and the end offsets of the partition.
+func (this *kafkaAdmin) partitionOffsets(tp TopicPartition) (int64, int64, error) {
+	conn, err := dialLeader(context.Background(), this.dialer, this.hosts, tp)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	return conn.ReadOffsets()
+}
+
+// controller connects to the cluster's controller, topics can only be created through it.
+func (this *kafkaAdmin) controller() (*k.Conn, error) {
+	conn, err := dialAny(this.dialer, this.hosts)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(this.dialer.Timeout))
+	broker, err := conn.Controller()
+	if err != nil {
+		return nil, err
+	}
+	return this.dialer.Dial("tcp", net.JoinHostPort(broker.Host, strconv.Itoa(broker.Port)))
+}
+
+func (this TopicSpec) topicConfig() k.TopicConfig {
+	out := k.TopicConfig{
+		Topic:             this.Topic,
+		NumPartitions:     this.Partitions,
+		ReplicationFactor: this.ReplicationFactor,
+	}
+	if out.NumPartitions <= 0 {
+		out.NumPartitions = 1
+	}
+	if out.ReplicationFactor <= 0 {
+		out.ReplicationFactor = 1
+	}
+
+	names := make([]string, 0, len(this.Config))
+	for name := range this.Config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out.ConfigEntries = append(out.ConfigEntries, k.ConfigEntry{ConfigName: name, ConfigValue: this.Config[name]})
+	}
+	return out
+}
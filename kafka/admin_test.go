@@ -0,0 +1,92 @@
+package kafka
+
+import (
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTopicSpec_Defaults(t *testing.T) {
+	config := TopicSpec{
+		Topic:  "topic",
+		Config: map[string]string{"retention.ms": "3600000", "cleanup.policy": "compact"},
+	}.topicConfig()
+
+	assert.EqualValues(t, "topic", config.Topic)
+	assert.EqualValues(t, 1, config.NumPartitions)
+	assert.EqualValues(t, 1, config.ReplicationFactor)
+	assert.EqualValues(t, []k.ConfigEntry{
+		{ConfigName: "cleanup.policy", ConfigValue: "compact"},
+		{ConfigName: "retention.ms", ConfigValue: "3600000"},
+	}, config.ConfigEntries)
+}
+
+func TestKafkaAdmin_EnsureTopic(t *testing.T) {
+	admin := NewKafkaAdmin([]string{"localhost:9092"}, nil, nil)
+	spec := TopicSpec{Topic: "test_admin_topic", Partitions: 3, Config: map[string]string{"retention.ms": "3600000"}}
+	assert.Nil(t, admin.EnsureTopic(spec))
+
+	// ensuring an existing topic is a no-op
+	assert.Nil(t, admin.EnsureTopic(spec))
+
+	topics, err := admin.ListTopics()
+	assert.Nil(t, err)
+	assert.Contains(t, topics, "test_admin_topic")
+
+	conn, err := k.Dial("tcp", "localhost:9092")
+	panicOnErr(err)
+	defer conn.Close()
+	partitions, err := conn.ReadPartitions("test_admin_topic")
+	assert.Nil(t, err)
+	assert.Len(t, partitions, 3)
+}
+
+func TestKafkaAdmin_DescribeGroupOffsets(t *testing.T) {
+	producer := NewKafkaSink(NewSinkConfig([]string{"localhost:9092"}, "test_admin_offsets"), nil)
+	panicOnErr(producer.Batch(
+		s.Entry{Key: "entry0", Value: []byte("value 0")},
+		s.Entry{Key: "entry1", Value: []byte("value 1")},
+		s.Entry{Key: "entry2", Value: []byte("value 2")},
+	))
+
+	admin := NewKafkaAdmin([]string{"localhost:9092"}, nil, nil)
+	tp := TopicPartition{Topic: "test_admin_offsets", Partition: 0}
+
+	offsets, err := admin.DescribeGroupOffsets("test_admin_offsets_cg", "test_admin_offsets")
+	assert.Nil(t, err)
+	assert.EqualValues(t, GroupOffset{Committed: -1, End: 3, Lag: 3}, offsets[tp])
+
+	cfg := NewSourceConfig([]string{"localhost:9092"}, "test_admin_offsets", "test_admin_offsets_cg")
+	cfg.StartOffset = k.FirstOffset
+	cfg.CommitIntervalMs = 0
+	consumer, entries := startSource(t, cfg)
+	defer consumer.Stop()
+
+	e := nextEntry(t, entries)
+	assert.Nil(t, consumer.CommitEntry(e.Key))
+
+	offsets, err = admin.DescribeGroupOffsets("test_admin_offsets_cg", "test_admin_offsets")
+	assert.Nil(t, err)
+	assert.EqualValues(t, GroupOffset{Committed: 1, End: 3, Lag: 2}, offsets[tp])
+}
+
+func TestKafkaSink_AutoCreateTopic(t *testing.T) {
+	cfg := NewSinkConfig([]string{"localhost:9092"}, "test_sink_auto_created")
+	cfg.AutoCreateTopic = true
+	cfg.AutoCreateSpec = TopicSpec{Partitions: 2}
+	cfg.TopicExtractor = func(entry s.Entry) string {
+		return "test_sink_auto_created_" + entry.Key
+	}
+	created := NewKafkaSink(cfg, nil)
+	assert.Nil(t, created.Single(s.Entry{Key: "routed", Value: []byte("value")}))
+
+	conn, err := k.Dial("tcp", "localhost:9092")
+	panicOnErr(err)
+	defer conn.Close()
+	for _, topic := range []string{"test_sink_auto_created", "test_sink_auto_created_routed"} {
+		partitions, err := conn.ReadPartitions(topic)
+		assert.Nil(t, err)
+		assert.Len(t, partitions, 2, topic)
+	}
+}
@@ -0,0 +1,43 @@
+package kafka
+
+import (
+	"fmt"
+	k "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/gzip"
+	"github.com/segmentio/kafka-go/lz4"
+	"github.com/segmentio/kafka-go/snappy"
+)
+
+// Compression selects the codec the kafka sink compresses its message batches with, the codecs are registered
+// by this package so the kafka source reads compressed batches transparently.
+type Compression string
+
+const (
+	NoCompression     Compression = ""
+	GzipCompression   Compression = "gzip"
+	SnappyCompression Compression = "snappy"
+	LZ4Compression    Compression = "lz4"
+
+	// ZstdCompression requires kafka 2.1 or newer, and cgo since the codec wraps the zstd C library.
+	ZstdCompression Compression = "zstd"
+)
+
+// compressionCodecs holds the supported codecs, zstd is only registered when built with cgo.
+var compressionCodecs = map[Compression]func() k.CompressionCodec{
+	GzipCompression:   func() k.CompressionCodec { return gzip.NewCompressionCodec() },
+	SnappyCompression: func() k.CompressionCodec { return snappy.NewCompressionCodec() },
+	LZ4Compression:    func() k.CompressionCodec { return lz4.NewCompressionCodec() },
+}
+
+// newCompressionCodec returns the codec of the given compression, or nil when the messages shouldn't be compressed.
+func newCompressionCodec(compression Compression) (k.CompressionCodec, error) {
+	if compression == NoCompression {
+		return nil, nil
+	}
+
+	codec, found := compressionCodecs[compression]
+	if !found {
+		return nil, fmt.Errorf("unsupported kafka compression '%s'", compression)
+	}
+	return codec(), nil
+}
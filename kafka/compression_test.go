@@ -0,0 +1,67 @@
+package kafka
+
+import (
+	"fmt"
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestCompression_Codecs(t *testing.T) {
+	codec, err := newCompressionCodec(NoCompression)
+	assert.Nil(t, err)
+	assert.Nil(t, codec)
+
+	for _, compression := range supportedCompressions(t) {
+		codec, err := newCompressionCodec(compression)
+		assert.Nil(t, err)
+		assert.EqualValues(t, compression, codec.Name())
+	}
+
+	_, err = newCompressionCodec("brotli")
+	assert.NotNil(t, err)
+}
+
+func TestKafkaSource_ReadsCompressedBatches(t *testing.T) {
+	payload := strings.Repeat(`{"event":"login","tenant":"acme"}`, 100)
+	for _, compression := range supportedCompressions(t) {
+		topic := fmt.Sprintf("test_compressed_%s", compression)
+		cfg := NewSinkConfig([]string{"localhost:9092"}, topic)
+		cfg.Compression = compression
+		producer := NewKafkaSink(cfg, nil)
+
+		var entries []s.Entry
+		for i := 0; i < 5; i++ {
+			entries = append(entries, s.Entry{Key: fmt.Sprintf("entry%d", i), Value: []byte(payload)})
+		}
+		assert.Nil(t, producer.Batch(entries...))
+
+		sourceCfg := NewSourceConfig([]string{"localhost:9092"}, topic, topic+"_cg")
+		sourceCfg.StartOffset = k.FirstOffset
+		sourceCfg.ValueExtractor = RecordEntryFunc
+		compressed, received := startSource(t, sourceCfg)
+
+		for i := 0; i < 5; i++ {
+			e := nextEntry(t, received)
+			record := e.Value.(Record)
+			assert.EqualValues(t, fmt.Sprintf("entry%d", i), record.Key, "compression %s", compression)
+			assert.EqualValues(t, payload, record.Value, "compression %s", compression)
+		}
+		compressed.Stop()
+	}
+}
+
+// supportedCompressions returns the compressions this build supports, zstd is skipped when built without cgo.
+func supportedCompressions(t *testing.T) []Compression {
+	var out []Compression
+	for _, compression := range []Compression{GzipCompression, SnappyCompression, LZ4Compression, ZstdCompression} {
+		if _, found := compressionCodecs[compression]; !found {
+			t.Logf("skipping the %s compression, it isn't supported by this build", compression)
+			continue
+		}
+		out = append(out, compression)
+	}
+	return out
+}
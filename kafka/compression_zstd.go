@@ -0,0 +1,13 @@
+//go:build cgo
+// +build cgo
+
+package kafka
+
+import (
+	k "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/zstd"
+)
+
+func init() {
+	compressionCodecs[ZstdCompression] = func() k.CompressionCodec { return zstd.NewCompressionCodec() }
+}
@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	k "github.com/segmentio/kafka-go"
+	"sync"
+)
+
+// DedupHeader is the message header that carries the deduplication key of the idempotent mode, kafka-go doesn't
+// support idempotent or transactional producers so the duplicates are dropped by the consumer instead: the sink
+// stamps every message with a deduplication key and the source drops the messages whose key it has already
+// seen at another position, e.g. the duplicates that the writer's retries produce.
+const DedupHeader = "x-dedup-key"
+
+const defaultDedupWindowSize = 10000
+
+// messagePosition identifies a single message.
+type messagePosition struct {
+	tp     TopicPartition
+	offset int64
+}
+
+// dedupWindow remembers the position of the latest deduplication keys it has seen, once it's full
+// the oldest key is evicted whenever a new key is added.
+type dedupWindow struct {
+	mutex sync.Mutex
+	keys  map[string]messagePosition
+	ring  []string
+	next  int
+}
+
+func newDedupWindow(size int) *dedupWindow {
+	if size <= 0 {
+		size = defaultDedupWindowSize
+	}
+	return &dedupWindow{
+		keys: make(map[string]messagePosition, size),
+		ring: make([]string, 0, size),
+	}
+}
+
+func (this *dedupWindow) lookup(key string) (messagePosition, bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	position, found := this.keys[key]
+	return position, found
+}
+
+// add records the key at the given position, a key that is already in the window keeps its original position.
+func (this *dedupWindow) add(key string, position messagePosition) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if _, found := this.keys[key]; found {
+		return
+	}
+
+	if len(this.ring) < cap(this.ring) {
+		this.ring = append(this.ring, key)
+	} else {
+		delete(this.keys, this.ring[this.next])
+		this.ring[this.next] = key
+		this.next = (this.next + 1) % len(this.ring)
+	}
+	this.keys[key] = position
+}
+
+// isDuplicate returns true if the message's deduplication key was already seen at another position,
+// fetching the same message again (e.g. after a reconnect) isn't a duplicate.
+func (this *dedupWindow) isDuplicate(m k.Message) bool {
+	key, found := dedupKey(m)
+	if !found {
+		return false
+	}
+
+	position := messagePosition{tp: TopicPartition{Topic: m.Topic, Partition: m.Partition}, offset: m.Offset}
+	if seen, found := this.lookup(key); found {
+		return seen != position
+	}
+	this.add(key, position)
+	return false
+}
+
+func dedupKey(m k.Message) (string, bool) {
+	for _, header := range m.Headers {
+		if header.Key == DedupHeader {
+			return string(header.Value), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDedupWindow_Eviction(t *testing.T) {
+	window := newDedupWindow(2)
+	window.add("a", messagePosition{offset: 1})
+	window.add("b", messagePosition{offset: 2})
+	window.add("a", messagePosition{offset: 3})
+
+	position, found := window.lookup("a")
+	assert.True(t, found)
+	assert.EqualValues(t, 1, position.offset)
+
+	window.add("c", messagePosition{offset: 4})
+	_, found = window.lookup("a")
+	assert.False(t, found)
+	_, found = window.lookup("b")
+	assert.True(t, found)
+	_, found = window.lookup("c")
+	assert.True(t, found)
+}
+
+func TestDedupWindow_IsDuplicate(t *testing.T) {
+	window := newDedupWindow(10)
+	header := []k.Header{{Key: DedupHeader, Value: []byte("invoice-1")}}
+	first := k.Message{Topic: "billing", Partition: 0, Offset: 5, Headers: header}
+	retried := k.Message{Topic: "billing", Partition: 0, Offset: 6, Headers: header}
+
+	assert.False(t, window.isDuplicate(first))
+	assert.True(t, window.isDuplicate(retried))
+
+	// fetching the same message again isn't a duplicate
+	assert.False(t, window.isDuplicate(first))
+
+	// messages without a deduplication key are never duplicates
+	plain := k.Message{Topic: "billing", Partition: 0, Offset: 7}
+	assert.False(t, window.isDuplicate(plain))
+	assert.False(t, window.isDuplicate(plain))
+}
+
+func TestKafkaSink_IdempotentMode(t *testing.T) {
+	cfg := NewSinkConfig([]string{"localhost:9092"}, "test_sink_idempotent")
+	cfg.DedupKeyExtractor = func(entry s.Entry) string {
+		return entry.Key
+	}
+	idempotent := NewKafkaSink(cfg, nil)
+
+	assert.Nil(t, idempotent.Batch(
+		s.Entry{Key: "invoice-1", Value: []byte("value 1")},
+		s.Entry{Key: "invoice-1", Value: []byte("value 1")},
+	))
+	assert.Nil(t, idempotent.Single(s.Entry{Key: "invoice-1", Value: []byte("value 1")}))
+	assert.Nil(t, idempotent.Single(s.Entry{Key: "invoice-2", Value: []byte("value 2")}))
+
+	messages := readTopic("test_sink_idempotent", 2)
+	assert.EqualValues(t, "value 1", messages[0].Value)
+	assert.EqualValues(t, "value 2", messages[1].Value)
+	key, found := dedupKey(messages[1])
+	assert.True(t, found)
+	assert.EqualValues(t, "invoice-2", key)
+}
+
+func TestSinkMessage_DedupHeader(t *testing.T) {
+	cfg := NewSinkConfig([]string{"localhost:9092"}, "topic")
+	cfg.Serializer = func(entry s.Entry) []byte { return entry.Value.([]byte) }
+	cfg.HeadersExtractor = func(entry s.Entry) map[string][]byte {
+		return map[string][]byte{DedupHeader: []byte("extracted"), "tenant": []byte("acme")}
+	}
+	cfg.DedupKeyExtractor = func(entry s.Entry) string { return entry.Key }
+	unconnected := &kafkaSink{cfg: cfg, extractor: func(entry s.Entry) string { return entry.Key }}
+
+	m := unconnected.newMessage(s.Entry{Key: "invoice-1", Value: []byte("value")})
+	assert.EqualValues(t, []k.Header{{Key: "tenant", Value: []byte("acme")}, {Key: DedupHeader, Value: []byte("invoice-1")}}, m.Headers)
+}
+
+func TestKafkaSource_DropsDuplicates(t *testing.T) {
+	// a sink without a deduplication window simulates the duplicates that the writer's retries produce
+	cfg := NewSinkConfig([]string{"localhost:9092"}, "test_source_dedup")
+	cfg.HeadersExtractor = func(entry s.Entry) map[string][]byte {
+		return map[string][]byte{DedupHeader: []byte(entry.Key)}
+	}
+	producer := NewKafkaSink(cfg, nil)
+	for _, key := range []string{"invoice-1", "invoice-1", "invoice-2", "invoice-1", "invoice-3"} {
+		panicOnErr(producer.Single(s.Entry{Key: key, Value: []byte(key)}))
+	}
+
+	sourceCfg := NewSourceConfig([]string{"localhost:9092"}, "test_source_dedup", "test_source_dedup_cg")
+	sourceCfg.StartOffset = k.FirstOffset
+	sourceCfg.CommitIntervalMs = 0
+	sourceCfg.DedupWindowSize = 100
+	deduplicated, entries := startSource(t, sourceCfg)
+	defer deduplicated.Stop()
+
+	var keys []string
+	for i := 0; i < 3; i++ {
+		e := nextEntry(t, entries)
+		keys = append(keys, e.Key)
+	}
+
+	assert.EqualValues(t, []string{
+		"0-invoice-1",
+		"2-invoice-2",
+		"4-invoice-3",
+	}, keys)
+
+	// the duplicates were committed along with the delivered entries
+	assert.Nil(t, deduplicated.CommitEntry(keys...))
+	assert.EqualValues(t, 5, deduplicated.Progress()[TopicPartition{Topic: "test_source_dedup"}].Committed)
+}
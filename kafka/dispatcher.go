@@ -0,0 +1,220 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultDispatcherWorkers       = 8
+	defaultDispatcherQueueCapacity = 100
+)
+
+// DispatchHandler processes a single entry, the entry is committed once the handler returns nil.
+type DispatchHandler func(entry s.Entry) error
+
+// kafkaDispatcher processes the entries of a kafka source with a fixed set of workers, every entry is routed
+// to a worker by the hash of its ordering key so the entries of a key are processed one at a time, in the order
+// they were fetched. The source's OffsetTracker keeps track of the entries that were completed, so committing
+// them as soon as they complete never moves a partition's watermark past an entry that is still in progress.
+type kafkaDispatcher struct {
+	source  *kafkaSource
+	cfg     DispatcherConfig
+	handler DispatchHandler
+
+	workers   []chan s.Entry
+	wg        sync.WaitGroup
+	completed chan string
+
+	mutex   sync.Mutex
+	started bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	doneCh  chan struct{}
+}
+
+func NewKafkaDispatcher(source *kafkaSource, cfg DispatcherConfig, handler DispatchHandler) *kafkaDispatcher {
+	if source == nil || handler == nil {
+		panic(fmt.Errorf("the kafka dispatcher requires a source and a handler"))
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultDispatcherWorkers
+	}
+	if cfg.QueueCapacity <= 0 {
+		cfg.QueueCapacity = defaultDispatcherQueueCapacity
+	}
+
+	workers := make([]chan s.Entry, cfg.Workers)
+	for idx := range workers {
+		workers[idx] = make(chan s.Entry, cfg.QueueCapacity)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &kafkaDispatcher{
+		source:    source,
+		cfg:       cfg,
+		handler:   handler,
+		workers:   workers,
+		completed: make(chan string, cfg.Workers*cfg.QueueCapacity),
+		ctx:       ctx,
+		cancel:    cancel,
+		doneCh:    make(chan struct{}),
+	}
+}
+
+// Start dispatches the entries the source pushes into the given channel until the channel is closed or
+// the dispatcher is stopped, it blocks until every dispatched entry was processed and committed.
+func (this *kafkaDispatcher) Start(entries s.EntryChannel, errorChannel s.ErrorChannel) {
+	this.mutex.Lock()
+	this.started = true
+	this.mutex.Unlock()
+	defer close(this.doneCh)
+
+	for idx := range this.workers {
+		this.wg.Add(1)
+		go this.work(this.workers[idx], errorChannel)
+	}
+
+	committed := make(chan struct{})
+	go func() {
+		defer close(committed)
+		this.commit(errorChannel)
+	}()
+
+	this.dispatch(entries)
+
+	for idx := range this.workers {
+		close(this.workers[idx])
+	}
+	this.wg.Wait()
+	close(this.completed)
+	<-committed
+}
+
+// Stop stops taking entries from the source and waits until the entries that were already dispatched
+// were processed and committed, stop the dispatcher before the source so the source's final commit
+// includes them. The entries that weren't dispatched stay uncommitted and will be redelivered.
+func (this *kafkaDispatcher) Stop() {
+	this.cancel()
+
+	this.mutex.Lock()
+	started := this.started
+	this.mutex.Unlock()
+	if started {
+		<-this.doneCh
+	}
+}
+
+func (this *kafkaDispatcher) dispatch(entries s.EntryChannel) {
+	for {
+		select {
+		case <-this.ctx.Done():
+			return
+		case entry, ok := <-entries:
+			if !ok {
+				return
+			}
+
+			select {
+			case this.workers[this.workerOf(entry)] <- entry:
+			case <-this.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (this *kafkaDispatcher) work(queue chan s.Entry, errorChannel s.ErrorChannel) {
+	defer this.wg.Done()
+
+	for entry := range queue {
+		err := this.handler(entry)
+		if err == nil {
+			this.completed <- entry.Key
+			continue
+		}
+
+		reportError(this.ctx, errorChannel, fmt.Errorf("the kafka dispatcher failed to process entry '%s': %s", entry.Key, err.Error()))
+		if this.cfg.RetryFailures {
+			if err := this.retry(err, entry.Key); err != nil {
+				reportError(this.ctx, errorChannel, NewSourceError(err))
+			}
+		}
+	}
+}
+
+// retry hands a failed entry to the source's retry tiers, or to its dead letter topic.
+func (this *kafkaDispatcher) retry(cause error, key string) error {
+	if len(this.source.retries) > 0 {
+		return this.source.RetryEntryWithError(cause, key)
+	}
+	return this.source.NackEntryWithError(cause, key)
+}
+
+// commit feeds the completed entries back to the source, every round commits everything
+// that was completed since the previous round.
+func (this *kafkaDispatcher) commit(errorChannel s.ErrorChannel) {
+	for key := range this.completed {
+		keys := []string{key}
+	drain:
+		for {
+			select {
+			case next, ok := <-this.completed:
+				if !ok {
+					break drain
+				}
+				keys = append(keys, next)
+			default:
+				break drain
+			}
+		}
+
+		if err := this.source.CommitEntry(keys...); err != nil {
+			reportError(this.ctx, errorChannel, NewSourceError(err))
+		}
+	}
+}
+
+// workerOf returns the worker of the entry's ordering key, entries of kafka messages that
+// don't have a key aren't ordered and are spread by their entry key instead.
+func (this *kafkaDispatcher) workerOf(entry s.Entry) int {
+	key := this.orderingKey(entry)
+	if key == "" {
+		key = entry.Key
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(len(this.workers)))
+}
+
+// orderingKey derives the ordering key from the entry itself and not from the source's tracker,
+// so the entries that are still queued keep their worker after a rebalance or a reconnect.
+func (this *kafkaDispatcher) orderingKey(entry s.Entry) string {
+	if this.cfg.OrderingKey != nil {
+		if key := this.cfg.OrderingKey(entry); key != "" {
+			return key
+		}
+	}
+
+	switch value := entry.Value.(type) {
+	case Record:
+		return string(value.Key)
+	case k.Message:
+		return string(value.Key)
+	}
+
+	// the entry keys generated by MessageKey are the offset followed by the message key
+	if idx := strings.IndexByte(entry.Key, '-'); idx > 0 {
+		if _, err := strconv.ParseInt(entry.Key[:idx], 10, 64); err == nil {
+			return entry.Key[idx+1:]
+		}
+	}
+	return ""
+}
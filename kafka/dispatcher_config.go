@@ -0,0 +1,39 @@
+package kafka
+
+import s "github.com/matang28/go-streams"
+
+type DispatcherConfig struct {
+	// Workers sets the number of entries that are processed concurrently, entries with the
+	// same ordering key are always processed by the same worker in the order they were fetched.
+	//
+	// Default: 8
+	Workers int
+
+	// QueueCapacity sets the number of entries that can wait for each worker, the dispatcher
+	// stops taking entries from the source while the queue of the next entry's worker is full.
+	//
+	// Default: 100
+	QueueCapacity int
+
+	// OrderingKey optionally returns the key the entries are ordered by, entries that return
+	// an empty key fall back to the key of their kafka message.
+	//
+	// Default: the key of the kafka message, taken from the entry's Record or k.Message value, or
+	// from its entry key when it was generated by MessageKey
+	OrderingKey func(entry s.Entry) string
+
+	// RetryFailures sends the entries the handler failed on to the source's RetryTiers (or to its
+	// DeadLetterTopic when it has no retry tiers), so they don't hold back their partitions.
+	// Otherwise they are only reported and stay uncommitted, they will be redelivered once the
+	// partition is consumed again (after a restart or a rebalance).
+	//
+	// Default: false
+	RetryFailures bool
+}
+
+func NewDispatcherConfig() DispatcherConfig {
+	var out DispatcherConfig
+	out.Workers = defaultDispatcherWorkers
+	out.QueueCapacity = defaultDispatcherQueueCapacity
+	return out
+}
@@ -0,0 +1,126 @@
+package kafka
+
+import (
+	"fmt"
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// trackedEntries tracks a message per key and offset on a single partition, like the source does when it fetches them.
+func trackedEntries(source *kafkaSource, keys []string) []s.Entry {
+	var entries []s.Entry
+	for idx, key := range keys {
+		m := k.Message{Topic: "t", Partition: 0, Offset: int64(idx), Key: []byte(key), Value: []byte(fmt.Sprint(idx))}
+		source.offsets.Track(MessageKey(m), m)
+		entries = append(entries, s.Entry{Key: MessageKey(m), Value: m.Value})
+	}
+	return entries
+}
+
+func TestDispatcher_KeyOrdering(t *testing.T) {
+	source := NewKafkaSource(NewSourceConfig([]string{"localhost:9092"}, "t", "cg"))
+
+	var keys []string
+	for i := 0; i < 200; i++ {
+		keys = append(keys, fmt.Sprintf("key%d", i%10))
+	}
+	entries := trackedEntries(source, keys)
+
+	var mutex sync.Mutex
+	processed := make(map[string][]string)
+	cfg := NewDispatcherConfig()
+	cfg.Workers = 4
+	dispatcher := NewKafkaDispatcher(source, cfg, func(entry s.Entry) error {
+		time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+		key := strings.SplitN(entry.Key, "-", 2)[1]
+
+		mutex.Lock()
+		processed[key] = append(processed[key], entry.Key)
+		mutex.Unlock()
+		return nil
+	})
+
+	channel := make(s.EntryChannel, len(entries))
+	for _, entry := range entries {
+		channel <- entry
+	}
+	close(channel)
+	dispatcher.Start(channel, make(s.ErrorChannel, 100))
+
+	for idx, key := range keys[:10] {
+		var expected []string
+		for offset := idx; offset < len(entries); offset += 10 {
+			expected = append(expected, entries[offset].Key)
+		}
+		assert.EqualValues(t, expected, processed[key])
+	}
+
+	tp := TopicPartition{Topic: "t", Partition: 0}
+	assert.EqualValues(t, len(entries), source.Progress()[tp].Watermark)
+	assert.EqualValues(t, 0, source.offsets.Outstanding())
+}
+
+func TestDispatcher_FailureHoldsBackWatermark(t *testing.T) {
+	source := NewKafkaSource(NewSourceConfig([]string{"localhost:9092"}, "t", "cg"))
+	entries := trackedEntries(source, []string{"a", "b", "c", "d"})
+
+	errs := make(s.ErrorChannel, 10)
+	dispatcher := NewKafkaDispatcher(source, NewDispatcherConfig(), func(entry s.Entry) error {
+		if string(entry.Value.([]byte)) == "1" {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	})
+
+	channel := make(s.EntryChannel, len(entries))
+	go dispatcher.Start(channel, errs)
+	for _, entry := range entries {
+		channel <- entry
+	}
+
+	select {
+	case err := <-errs:
+		assert.Contains(t, err.Error(), entries[1].Key)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout while waiting for the failure")
+	}
+	dispatcher.Stop()
+
+	progress := source.Progress()[TopicPartition{Topic: "t", Partition: 0}]
+	assert.EqualValues(t, 1, progress.Watermark)
+	assert.EqualValues(t, 1, progress.Pending)
+	assert.EqualValues(t, 2, progress.Acked)
+}
+
+func TestDispatcher_OrderingKey(t *testing.T) {
+	source := NewKafkaSource(NewSourceConfig([]string{"localhost:9092"}, "t", "cg"))
+	dispatcher := NewKafkaDispatcher(source, NewDispatcherConfig(), func(entry s.Entry) error { return nil })
+
+	m := k.Message{Topic: "t", Offset: 7, Key: []byte("user-1"), Value: []byte("value")}
+	assert.EqualValues(t, "user-1", dispatcher.orderingKey(s.Entry{Key: MessageKey(m), Value: m.Value}))
+	assert.EqualValues(t, "user-1", dispatcher.orderingKey(s.Entry{Key: "custom", Value: NewRecord(m)}))
+	assert.EqualValues(t, "user-1", dispatcher.orderingKey(s.Entry{Key: "custom", Value: m}))
+	assert.EqualValues(t, "", dispatcher.orderingKey(s.Entry{Key: "custom", Value: m.Value}))
+
+	// the entries of a key keep their worker even when the source's tracker doesn't know them anymore
+	later := k.Message{Topic: "t", Offset: 9, Key: []byte("user-1")}
+	source.offsets.Reset()
+	assert.EqualValues(t, dispatcher.workerOf(s.Entry{Key: MessageKey(m)}), dispatcher.workerOf(s.Entry{Key: MessageKey(later)}))
+}
+
+func TestDispatcher_Defaults(t *testing.T) {
+	source := NewKafkaSource(NewSourceConfig([]string{"localhost:9092"}, "t", "cg"))
+	dispatcher := NewKafkaDispatcher(source, DispatcherConfig{}, func(entry s.Entry) error { return nil })
+	assert.Len(t, dispatcher.workers, defaultDispatcherWorkers)
+	assert.EqualValues(t, defaultDispatcherQueueCapacity, cap(dispatcher.workers[0]))
+
+	assert.Panics(t, func() {
+		NewKafkaDispatcher(source, NewDispatcherConfig(), nil)
+	})
+}
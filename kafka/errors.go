@@ -0,0 +1,139 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"net"
+	"time"
+)
+
+// ErrorKind classifies the errors the kafka source may run into.
+type ErrorKind int
+
+const (
+	// TransientError is a network or broker failure that is expected to go away,
+	// the source will reconnect with an exponential backoff.
+	TransientError ErrorKind = 1
+
+	// RebalanceError is reported while the consumer group is being rebalanced,
+	// the reader recovers from it on its own.
+	RebalanceError ErrorKind = 2
+
+	// FatalError can't be recovered by retrying (e.g: authorization failures or a missing topic),
+	// the source will stop.
+	FatalError ErrorKind = 3
+)
+
+func (this ErrorKind) String() string {
+	switch this {
+	case TransientError:
+		return "transient"
+	case RebalanceError:
+		return "rebalance"
+	case FatalError:
+		return "fatal"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(this))
+	}
+}
+
+// ClassifyError returns the kind of the given error, errors that can't be
+// classified are considered transient.
+func ClassifyError(err error) ErrorKind {
+	switch e := err.(type) {
+	case *SourceError:
+		return e.Kind
+	case k.Error:
+		return classifyKafkaError(e)
+	case net.Error:
+		return TransientError
+	}
+
+	// io.EOF and io.ErrUnexpectedEOF are returned when a broker drops the connection
+	return TransientError
+}
+
+func classifyKafkaError(err k.Error) ErrorKind {
+	switch err {
+	case k.RebalanceInProgress,
+		k.IllegalGeneration,
+		k.UnknownMemberId:
+		return RebalanceError
+
+	case k.UnknownTopicOrPartition,
+		k.InvalidTopic,
+		k.InvalidGroupId,
+		k.TopicAuthorizationFailed,
+		k.GroupAuthorizationFailed,
+		k.ClusterAuthorizationFailed,
+		k.BrokerAuthorizationFailed,
+		k.UnsupportedSASLMechanism,
+		k.IllegalSASLState,
+		k.SASLAuthenticationFailed:
+		return FatalError
+	}
+	return TransientError
+}
+
+// SourceError wraps every error the kafka source reports on the error channel
+// together with its classification.
+type SourceError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func NewSourceError(err error) *SourceError {
+	if err == nil {
+		return nil
+	}
+	return &SourceError{Kind: ClassifyError(err), Err: err}
+}
+
+func (this *SourceError) Error() string {
+	return fmt.Sprintf("kafka source %s error: %s", this.Kind, this.Err.Error())
+}
+
+func (this *SourceError) Unwrap() error {
+	return this.Err
+}
+
+// OutageError is reported each time the source fails to reach kafka and is
+// about to wait for Backoff before its next reconnect attempt.
+type OutageError struct {
+	Err     error
+	Attempt int
+	Backoff time.Duration
+}
+
+func (this *OutageError) Error() string {
+	return fmt.Sprintf("kafka source lost its connection (attempt %d, retrying in %s): %s",
+		this.Attempt, this.Backoff, this.Err.Error())
+}
+
+func (this *OutageError) Unwrap() error {
+	return this.Err
+}
+
+// RecoveredError is reported once the source has reconnected to kafka after an outage,
+// it isn't an actual failure but it lets the error handler track the outage duration.
+// The outage only ends once a session was assigned its partitions or delivered an entry, so Attempts
+// keeps counting while kafka is reachable but the new sessions fail.
+type RecoveredError struct {
+	Attempts int
+	Downtime time.Duration
+}
+
+func (this *RecoveredError) Error() string {
+	return fmt.Sprintf("kafka source reconnected after %d attempts (down for %s)", this.Attempts, this.Downtime)
+}
+
+// reportError sends the error to the error channel unless the context is done first, so a pipeline
+// that has stopped draining its errors can't block the source while it's shutting down.
+func reportError(ctx context.Context, errorChannel s.ErrorChannel, err error) {
+	select {
+	case errorChannel <- err:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,62 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	assert.EqualValues(t, TransientError, ClassifyError(io.EOF))
+	assert.EqualValues(t, TransientError, ClassifyError(io.ErrUnexpectedEOF))
+	assert.EqualValues(t, TransientError, ClassifyError(&net.OpError{Op: "dial", Err: io.EOF}))
+	assert.EqualValues(t, TransientError, ClassifyError(k.LeaderNotAvailable))
+	assert.EqualValues(t, RebalanceError, ClassifyError(k.RebalanceInProgress))
+	assert.EqualValues(t, FatalError, ClassifyError(k.UnknownTopicOrPartition))
+	assert.EqualValues(t, FatalError, ClassifyError(k.SASLAuthenticationFailed))
+	assert.EqualValues(t, FatalError, ClassifyError(NewSourceError(k.TopicAuthorizationFailed)))
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	min := 100 * time.Millisecond
+	max := time.Second
+
+	assert.EqualValues(t, 100*time.Millisecond, reconnectBackoff(1, min, max))
+	assert.EqualValues(t, 200*time.Millisecond, reconnectBackoff(2, min, max))
+	assert.EqualValues(t, 800*time.Millisecond, reconnectBackoff(4, min, max))
+	assert.EqualValues(t, time.Second, reconnectBackoff(10, min, max))
+	assert.EqualValues(t, defaultReconnectBackoffMin, reconnectBackoff(1, 0, 0))
+}
+
+func TestReconnectBackoff_Outage(t *testing.T) {
+	source := NewKafkaSource(NewSourceConfig([]string{"localhost:9092"}, "t", "cg"))
+
+	// sessions that fail before consuming anything don't start the backoff over
+	attempt, outageStart := source.nextReconnect()
+	assert.EqualValues(t, 1, attempt)
+	attempt, since := source.nextReconnect()
+	assert.EqualValues(t, 2, attempt)
+	assert.EqualValues(t, outageStart, since)
+
+	source.resetReconnects()
+	attempt, _ = source.nextReconnect()
+	assert.EqualValues(t, 1, attempt)
+}
+
+func TestReportError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	buffered := make(s.ErrorChannel, 1)
+	reportError(ctx, buffered, fmt.Errorf("reported"))
+	assert.EqualError(t, <-buffered, "reported")
+
+	// nobody drains this channel, the report must give up once the context is done
+	cancel()
+	reportError(ctx, make(s.ErrorChannel), fmt.Errorf("dropped"))
+	reportError(ctx, nil, fmt.Errorf("dropped"))
+}
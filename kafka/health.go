@@ -0,0 +1,168 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	k "github.com/segmentio/kafka-go"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultHealthCheckTimeout = 10 * time.Second
+
+// HostHealth is the outcome of probing a single kafka host.
+type HostHealth struct {
+	Host      string
+	Reachable bool
+	Latency   time.Duration
+
+	// Err holds the reason the host isn't reachable.
+	Err error
+}
+
+// HealthReport is the outcome of a health check of all the configured kafka hosts.
+type HealthReport struct {
+	Hosts []HostHealth
+
+	// MissingTopics holds the checked topics that don't exist on the cluster.
+	MissingTopics []string
+
+	// MetadataErr is set when none of the reachable hosts returned the cluster's metadata,
+	// in that case the topics weren't checked.
+	MetadataErr error
+}
+
+// Reachable returns the hosts that are reachable.
+func (this HealthReport) Reachable() []string {
+	var out []string
+	for _, host := range this.Hosts {
+		if host.Reachable {
+			out = append(out, host.Host)
+		}
+	}
+	return out
+}
+
+// Healthy returns true if at least one host is reachable and all the checked topics exist.
+func (this HealthReport) Healthy() bool {
+	return this.Err() == nil && this.MetadataErr == nil && len(this.MissingTopics) == 0
+}
+
+// Err returns nil if at least one host is reachable, otherwise it returns the error of the first host
+// (the errors of all the hosts are available in Hosts).
+func (this HealthReport) Err() error {
+	if len(this.Hosts) == 0 {
+		return fmt.Errorf("no kafka hosts were configured")
+	}
+
+	for _, host := range this.Hosts {
+		if host.Reachable {
+			return nil
+		}
+	}
+	return this.Hosts[0].Err
+}
+
+// HealthChecker probes every configured kafka host and checks that the given topics exist,
+// the kafka source and sink use it to implement Ping.
+type HealthChecker struct {
+	hosts   []string
+	dialer  *k.Dialer
+	timeout time.Duration
+}
+
+func NewHealthChecker(hosts []string, tlsConfig *TLSConfig, saslConfig *SASLConfig) *HealthChecker {
+	dialer, err := newDialer(tlsConfig, saslConfig)
+	if err != nil {
+		panic(err)
+	}
+	return newHealthChecker(hosts, dialer)
+}
+
+func newHealthChecker(hosts []string, dialer *k.Dialer) *HealthChecker {
+	return &HealthChecker{hosts: hosts, dialer: dialer, timeout: defaultHealthCheckTimeout}
+}
+
+// Check probes all the hosts concurrently and checks that the given topics exist using the
+// metadata of the first reachable host, the connections are closed once the check is done.
+// A report with missing topics still has a nil Err since the brokers may create them on demand,
+// this is why Ping of the kafka source and sink only logs them.
+func (this *HealthChecker) Check(topics ...string) HealthReport {
+	out := HealthReport{Hosts: make([]HostHealth, len(this.hosts))}
+	conns := make([]*k.Conn, len(this.hosts))
+
+	var wg sync.WaitGroup
+	for idx, host := range this.hosts {
+		wg.Add(1)
+		go func(idx int, host string) {
+			defer wg.Done()
+			out.Hosts[idx], conns[idx] = this.probe(host)
+		}(idx, host)
+	}
+	wg.Wait()
+
+	defer func() {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}()
+
+	if len(topics) == 0 {
+		return out
+	}
+
+	out.MetadataErr = fmt.Errorf("none of the kafka hosts is reachable")
+	for _, conn := range conns {
+		if conn == nil {
+			continue
+		}
+
+		partitions, err := conn.ReadPartitions()
+		if err != nil {
+			out.MetadataErr = err
+			continue
+		}
+
+		existing := make(map[string]bool)
+		for _, partition := range partitions {
+			existing[partition.Topic] = true
+		}
+		for _, topic := range topics {
+			if !existing[topic] {
+				out.MissingTopics = append(out.MissingTopics, topic)
+			}
+		}
+		sort.Strings(out.MissingTopics)
+		out.MetadataErr = nil
+		break
+	}
+	return out
+}
+
+// probe connects to the host and asks it for the list of brokers, the connection is returned
+// only if the host is reachable.
+func (this *HealthChecker) probe(host string) (HostHealth, *k.Conn) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout)
+	defer cancel()
+
+	conn, err := this.dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return HostHealth{Host: host, Err: err}, nil
+	}
+
+	conn.SetDeadline(time.Now().Add(this.timeout))
+	brokers, err := conn.Brokers()
+	if err == nil && len(brokers) <= 0 {
+		err = fmt.Errorf("failed to get a valid list of kafka brokers")
+	}
+	if err != nil {
+		conn.Close()
+		return HostHealth{Host: host, Err: err}, nil
+	}
+
+	return HostHealth{Host: host, Reachable: true, Latency: time.Since(start)}, conn
+}
@@ -0,0 +1,42 @@
+package kafka
+
+import (
+	s "github.com/matang28/go-streams"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHealthChecker_Unreachable(t *testing.T) {
+	report := NewHealthChecker([]string{"localhost:1", "localhost:2"}, nil, nil).Check("topic")
+	assert.Len(t, report.Hosts, 2)
+	for _, host := range report.Hosts {
+		assert.False(t, host.Reachable)
+		assert.NotNil(t, host.Err)
+	}
+	assert.Empty(t, report.Reachable())
+	assert.EqualValues(t, report.Hosts[0].Err, report.Err())
+	assert.NotNil(t, report.MetadataErr)
+	assert.False(t, report.Healthy())
+}
+
+func TestHealthChecker_NoHosts(t *testing.T) {
+	report := NewHealthChecker(nil, nil, nil).Check()
+	assert.NotNil(t, report.Err())
+	assert.False(t, report.Healthy())
+}
+
+func TestHealthChecker_Check(t *testing.T) {
+	producer := NewKafkaSink(NewSinkConfig([]string{"localhost:9092"}, "test_health"), nil)
+	panicOnErr(producer.Single(s.Entry{Key: "entry1", Value: []byte("value")}))
+
+	report := NewHealthChecker([]string{"localhost:1", "localhost:9092"}, nil, nil).Check("test_health", "test_health_missing")
+	assert.EqualValues(t, []string{"localhost:9092"}, report.Reachable())
+	assert.NotNil(t, report.Hosts[0].Err)
+	assert.Nil(t, report.Err())
+	assert.Nil(t, report.MetadataErr)
+	assert.EqualValues(t, []string{"test_health_missing"}, report.MissingTopics)
+	assert.False(t, report.Healthy())
+
+	assert.True(t, producer.Health().Healthy())
+	assert.Nil(t, producer.Ping())
+}
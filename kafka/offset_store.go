@@ -0,0 +1,212 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// OffsetStore checkpoints the offsets of a source that isn't part of a consumer group, the stored
+// offset of a partition is the offset of the next message to consume.
+type OffsetStore interface {
+	// Load returns the stored offsets of the given partitions, partitions without a stored offset are omitted.
+	Load(partitions []TopicPartition) (map[TopicPartition]int64, error)
+
+	// Save stores the given offsets, the offsets of other partitions are kept as they are.
+	Save(offsets map[TopicPartition]int64) error
+}
+
+// DocumentStore is the minimal document database a document offset store needs,
+// the couchbase connector's document store implements it on top of a Couchbase bucket.
+type DocumentStore interface {
+	// Get returns the JSON document with the given id, or nil if it doesn't exist.
+	Get(id string) ([]byte, error)
+
+	// Upsert creates or replaces the JSON document with the given id.
+	Upsert(id string, doc []byte) error
+}
+
+// NewMemoryOffsetStore creates an offset store that only lives as long as the process, it's
+// useful for tests and for sources that are re-created (e.g. on a Rewind) within the same process.
+func NewMemoryOffsetStore() *memoryOffsetStore {
+	return &memoryOffsetStore{offsets: make(map[TopicPartition]int64)}
+}
+
+// NewFileOffsetStore creates an offset store that keeps all the offsets in a single JSON file,
+// the file is replaced atomically on every save.
+func NewFileOffsetStore(path string) *documentOffsetStore {
+	return NewDocumentOffsetStore(fileDocuments{}, path)
+}
+
+// NewDocumentOffsetStore creates an offset store that keeps all the offsets in a single JSON document,
+// the document must not be shared by sources that run concurrently.
+func NewDocumentOffsetStore(docs DocumentStore, id string) *documentOffsetStore {
+	return &documentOffsetStore{docs: docs, id: id}
+}
+
+type memoryOffsetStore struct {
+	mutex   sync.Mutex
+	offsets map[TopicPartition]int64
+}
+
+func (this *memoryOffsetStore) Load(partitions []TopicPartition) (map[TopicPartition]int64, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return pickOffsets(this.offsets, partitions), nil
+}
+
+func (this *memoryOffsetStore) Save(offsets map[TopicPartition]int64) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for tp, offset := range offsets {
+		this.offsets[tp] = offset
+	}
+	return nil
+}
+
+type documentOffsetStore struct {
+	docs DocumentStore
+	id   string
+
+	// offsets caches the content of the document once it was read.
+	mutex   sync.Mutex
+	offsets map[TopicPartition]int64
+}
+
+// storedOffset is the JSON representation of a single partition's offset.
+type storedOffset struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+type storedOffsets struct {
+	Offsets []storedOffset `json:"offsets"`
+}
+
+func (this *documentOffsetStore) Load(partitions []TopicPartition) (map[TopicPartition]int64, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	// the document is always read again, it may have been changed while the source was stopped
+	this.offsets = nil
+	offsets, err := this.read()
+	if err != nil {
+		return nil, err
+	}
+	return pickOffsets(offsets, partitions), nil
+}
+
+func (this *documentOffsetStore) Save(offsets map[TopicPartition]int64) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	current, err := this.read()
+	if err != nil {
+		return err
+	}
+
+	merged := make(map[TopicPartition]int64, len(current)+len(offsets))
+	for tp, offset := range current {
+		merged[tp] = offset
+	}
+	for tp, offset := range offsets {
+		merged[tp] = offset
+	}
+
+	var doc storedOffsets
+	for _, tp := range sortedPartitions(asPartitionSet(merged)) {
+		doc.Offsets = append(doc.Offsets, storedOffset{Topic: tp.Topic, Partition: tp.Partition, Offset: merged[tp]})
+	}
+	bytes, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	if err := this.docs.Upsert(this.id, bytes); err != nil {
+		return fmt.Errorf("failed to save the kafka offsets to '%s': %s", this.id, err.Error())
+	}
+	this.offsets = merged
+	return nil
+}
+
+// read returns the cached offsets, reading the document if it wasn't read yet, must be called while holding the mutex.
+func (this *documentOffsetStore) read() (map[TopicPartition]int64, error) {
+	if this.offsets != nil {
+		return this.offsets, nil
+	}
+
+	bytes, err := this.docs.Get(this.id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the kafka offsets from '%s': %s", this.id, err.Error())
+	}
+
+	offsets := make(map[TopicPartition]int64)
+	if len(bytes) > 0 {
+		var doc storedOffsets
+		if err := json.Unmarshal(bytes, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse the kafka offsets of '%s': %s", this.id, err.Error())
+		}
+		for _, stored := range doc.Offsets {
+			offsets[TopicPartition{Topic: stored.Topic, Partition: stored.Partition}] = stored.Offset
+		}
+	}
+
+	this.offsets = offsets
+	return offsets, nil
+}
+
+// fileDocuments stores every document in the file its id points at.
+type fileDocuments struct{}
+
+func (this fileDocuments) Get(path string) ([]byte, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return bytes, err
+}
+
+// Upsert writes the document to a temporary file next to the target which is then renamed,
+// so a crash never leaves a partially written file behind.
+func (this fileDocuments) Upsert(path string, doc []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(doc); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func pickOffsets(offsets map[TopicPartition]int64, partitions []TopicPartition) map[TopicPartition]int64 {
+	out := make(map[TopicPartition]int64, len(partitions))
+	for _, tp := range partitions {
+		if offset, found := offsets[tp]; found {
+			out[tp] = offset
+		}
+	}
+	return out
+}
+
+func asPartitionSet(offsets map[TopicPartition]int64) map[TopicPartition]bool {
+	out := make(map[TopicPartition]bool, len(offsets))
+	for tp := range offsets {
+		out[tp] = true
+	}
+	return out
+}
@@ -0,0 +1,177 @@
+package kafka
+
+import (
+	"fmt"
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var (
+	storeTp0 = TopicPartition{Topic: "t", Partition: 0}
+	storeTp1 = TopicPartition{Topic: "t", Partition: 1}
+)
+
+func TestOffsetStore_Memory(t *testing.T) {
+	testOffsetStore(t, NewMemoryOffsetStore())
+}
+
+func TestOffsetStore_File(t *testing.T) {
+	dir, err := ioutil.TempDir("", "offsets")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "offsets.json")
+	testOffsetStore(t, NewFileOffsetStore(path))
+
+	// a new store reads what the previous one has saved
+	offsets, err := NewFileOffsetStore(path).Load([]TopicPartition{storeTp0, storeTp1})
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[TopicPartition]int64{storeTp0: 5, storeTp1: 2}, offsets)
+
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestOffsetStore_Document(t *testing.T) {
+	docs := &fakeDocuments{docs: make(map[string][]byte)}
+	testOffsetStore(t, NewDocumentOffsetStore(docs, "offsets"))
+	assert.JSONEq(t, `{"offsets":[{"topic":"t","partition":0,"offset":5},{"topic":"t","partition":1,"offset":2}]}`,
+		string(docs.docs["offsets"]))
+
+	docs.err = fmt.Errorf("unavailable")
+	_, err := NewDocumentOffsetStore(docs, "offsets").Load([]TopicPartition{storeTp0})
+	assert.NotNil(t, err)
+}
+
+func testOffsetStore(t *testing.T, store OffsetStore) {
+	offsets, err := store.Load([]TopicPartition{storeTp0, storeTp1})
+	assert.Nil(t, err)
+	assert.Empty(t, offsets)
+
+	assert.Nil(t, store.Save(map[TopicPartition]int64{storeTp0: 3, storeTp1: 2}))
+	assert.Nil(t, store.Save(map[TopicPartition]int64{storeTp0: 5}))
+
+	offsets, err = store.Load([]TopicPartition{storeTp0})
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[TopicPartition]int64{storeTp0: 5}, offsets)
+}
+
+type fakeDocuments struct {
+	docs map[string][]byte
+	err  error
+}
+
+func (this *fakeDocuments) Get(id string) ([]byte, error) {
+	return this.docs[id], this.err
+}
+
+func (this *fakeDocuments) Upsert(id string, doc []byte) error {
+	this.docs[id] = doc
+	return this.err
+}
+
+func TestKafkaSource_StaticPartitions(t *testing.T) {
+	admin := NewKafkaAdmin([]string{"localhost:9092"}, nil, nil)
+	panicOnErr(admin.EnsureTopic(TopicSpec{Topic: "test_source_static", Partitions: 2, ReplicationFactor: 1}))
+
+	cfg := NewSinkConfig([]string{"localhost:9092"}, "test_source_static")
+	cfg.PartitionFunc = func(record Record, partitions []int) int {
+		return int(record.Key[len(record.Key)-1]-'0') % len(partitions)
+	}
+	producer := NewKafkaSink(cfg, nil)
+	panicOnErr(producer.Batch(
+		s.Entry{Key: "entry0", Value: []byte("p0-first")},
+		s.Entry{Key: "entry1", Value: []byte("p1-first")},
+		s.Entry{Key: "entry2", Value: []byte("p0-second")},
+	))
+
+	store := NewMemoryOffsetStore()
+	newStatic := func() *kafkaSource {
+		cfg := NewSourceConfig([]string{"localhost:9092"}, "test_source_static", "")
+		cfg.StartOffset = k.FirstOffset
+		cfg.AllPartitions = true
+		cfg.OffsetStore = store
+		cfg.CommitIntervalMs = 0
+		cfg.ShutdownTimeoutSec = 1
+		return NewKafkaSource(cfg)
+	}
+
+	source := newStatic()
+	entries := make(s.EntryChannel, 10)
+	go source.Start(entries, make(s.ErrorChannel, 100))
+
+	received := make(map[string]string)
+	for i := 0; i < 3; i++ {
+		e := nextEntry(t, entries)
+		received[string(e.Value.([]byte))] = e.Key
+	}
+	assert.Nil(t, source.CommitEntry(received["p0-first"], received["p1-first"]))
+	assert.NotNil(t, source.Stop())
+
+	tp0 := TopicPartition{Topic: "test_source_static", Partition: 0}
+	tp1 := TopicPartition{Topic: "test_source_static", Partition: 1}
+	offsets, err := store.Load([]TopicPartition{tp0, tp1})
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[TopicPartition]int64{tp0: 1, tp1: 1}, offsets)
+
+	// the next source resumes from the stored offsets
+	source = newStatic()
+	entries = make(s.EntryChannel, 10)
+	go source.Start(entries, make(s.ErrorChannel, 100))
+	defer source.Stop()
+
+	e := nextEntry(t, entries)
+	assert.EqualValues(t, "p0-second", e.Value)
+}
+
+func TestKafkaSource_StaticPartitions_CommitInterval(t *testing.T) {
+	producer := NewKafkaSink(NewSinkConfig([]string{"localhost:9092"}, "test_source_static_interval"), nil)
+	panicOnErr(producer.Single(s.Entry{Key: "entry0", Value: []byte("interval value")}))
+
+	// keeps the default CommitIntervalMs, the store is saved to periodically and not only on Stop
+	store := NewMemoryOffsetStore()
+	cfg := NewSourceConfig([]string{"localhost:9092"}, "test_source_static_interval", "")
+	cfg.StartOffset = k.FirstOffset
+	cfg.OffsetStore = store
+	source, entries := startSource(t, cfg)
+	defer source.Stop()
+
+	e := nextEntry(t, entries)
+	assert.Nil(t, source.CommitEntry(e.Key))
+
+	tp := TopicPartition{Topic: "test_source_static_interval", Partition: 0}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		offsets, err := store.Load([]TopicPartition{tp})
+		assert.Nil(t, err)
+		if offsets[tp] == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the offset store wasn't saved to before the source was stopped")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestKafkaSource_StaticPartitions_Explicit(t *testing.T) {
+	cfg := NewSourceConfig([]string{"localhost:9092"}, "t", "")
+	cfg.Topics = []string{"u"}
+	cfg.Partitions = []int{1, 2}
+	source := NewKafkaSource(cfg)
+
+	partitions, err := source.staticPartitions([]string{"t", "u"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []TopicPartition{{"t", 1}, {"t", 2}, {"u", 1}, {"u", 2}}, partitions)
+
+	offsets, err := source.storedOffsets(partitions)
+	assert.Nil(t, err)
+	assert.EqualValues(t, k.FirstOffset, offsets[TopicPartition{"u", 2}])
+}
@@ -0,0 +1,317 @@
+package kafka
+
+import (
+	"fmt"
+	k "github.com/segmentio/kafka-go"
+	"sync"
+)
+
+// TopicPartition identifies a single partition of a topic.
+type TopicPartition struct {
+	Topic     string
+	Partition int
+}
+
+func (this TopicPartition) String() string {
+	return fmt.Sprintf("%s[%d]", this.Topic, this.Partition)
+}
+
+// PartitionProgress describes the commit progress of a single partition.
+type PartitionProgress struct {
+	// Number of fetched entries that weren't acknowledged yet.
+	Pending int
+
+	// Number of acknowledged entries that can't be committed yet because an
+	// earlier entry of the same partition is still pending.
+	Acked int
+
+	// The next offset to consume according to the acknowledged entries
+	// (the highest contiguous acknowledged offset + 1), -1 if nothing was acknowledged yet.
+	Watermark int64
+
+	// The latest watermark that was committed to kafka, -1 if nothing was committed yet.
+	Committed int64
+}
+
+// OffsetTracker keeps the fetched messages of each partition in the order they were fetched and
+// only advances the partition's watermark up to the highest contiguous acknowledged offset, this way
+// committing the watermark never skips a message that wasn't processed yet.
+// Entry keys don't have to be unique across partitions (the default MessageKey isn't), the messages
+// tracked under the same key are resolved in the order they were fetched.
+type OffsetTracker struct {
+	mutex        sync.Mutex
+	keys         map[string][]trackedOffset
+	partitions   map[TopicPartition]*partitionOffsets
+	keepMessages bool
+}
+
+type trackedOffset struct {
+	tp     TopicPartition
+	offset int64
+
+	// the tracked message, only kept when the tracker keeps messages so a pending entry can be
+	// sent to the dead letter or to a retry topic
+	message k.Message
+}
+
+type partitionOffsets struct {
+	// fetched offsets, in the order they were fetched
+	queue []int64
+
+	// every offset in queue that wasn't acknowledged yet
+	pending map[int64]bool
+
+	// number of acknowledged offsets in queue
+	acked int
+
+	watermark int64
+	committed int64
+}
+
+func NewOffsetTracker() *OffsetTracker {
+	return newOffsetTracker(true)
+}
+
+// newOffsetTracker creates a tracker that only keeps the offsets of the tracked messages unless
+// keepMessages is set, Message doesn't find anything in that case.
+func newOffsetTracker(keepMessages bool) *OffsetTracker {
+	return &OffsetTracker{
+		keys:         make(map[string][]trackedOffset),
+		partitions:   make(map[TopicPartition]*partitionOffsets),
+		keepMessages: keepMessages,
+	}
+}
+
+// Track registers a fetched message under the given entry key, messages must be tracked
+// in the order they were fetched from their partition.
+func (this *OffsetTracker) Track(key string, m k.Message) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.track(key, m)
+}
+
+// TrackBatch registers a batch of fetched messages under their entry keys (keys[i] belongs to messages[i])
+// while holding the lock only once.
+func (this *OffsetTracker) TrackBatch(keys []string, messages []k.Message) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for idx := range messages {
+		this.track(keys[idx], messages[idx])
+	}
+}
+
+func (this *OffsetTracker) track(key string, m k.Message) {
+	tp := TopicPartition{Topic: m.Topic, Partition: m.Partition}
+	for _, existing := range this.keys[key] {
+		if existing.tp == tp && existing.offset == m.Offset {
+			// the same message was fetched again, it's still tracked
+			return
+		}
+	}
+
+	partition := this.partition(tp)
+	partition.queue = append(partition.queue, m.Offset)
+	partition.pending[m.Offset] = true
+	tracked := trackedOffset{tp: tp, offset: m.Offset}
+	if this.keepMessages {
+		tracked.message = m
+	}
+	this.keys[key] = append(this.keys[key], tracked)
+}
+
+// Forget removes the latest tracked message of a partition when it was never handed
+// to the stream, so it won't hold back its partition's watermark.
+func (this *OffsetTracker) Forget(key string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	tracked, found := this.latest(key)
+	if !found {
+		return
+	}
+
+	partition := this.partitions[tracked.tp]
+	last := len(partition.queue) - 1
+	if last >= 0 && partition.queue[last] == tracked.offset {
+		delete(partition.pending, tracked.offset)
+		partition.queue = partition.queue[:last]
+	}
+}
+
+// Message returns the message of a tracked entry that wasn't acknowledged yet.
+func (this *OffsetTracker) Message(key string) (k.Message, bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	tracked := this.keys[key]
+	if len(tracked) == 0 || !this.keepMessages {
+		return k.Message{}, false
+	}
+	return tracked[0].message, true
+}
+
+// Ack marks the entries with the given keys as processed, unknown keys are ignored.
+// An entry key that was fetched from several partitions acknowledges its earliest fetched message.
+func (this *OffsetTracker) Ack(keys ...string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	touched := make(map[*partitionOffsets]bool)
+	for _, key := range keys {
+		tracked, found := this.earliest(key)
+		if !found {
+			continue
+		}
+
+		partition := this.partitions[tracked.tp]
+		if partition.pending[tracked.offset] {
+			delete(partition.pending, tracked.offset)
+			partition.acked++
+			touched[partition] = true
+		}
+	}
+
+	for partition := range touched {
+		this.advance(partition)
+	}
+}
+
+// Committable returns the watermark of every partition that has advanced since it was last committed.
+func (this *OffsetTracker) Committable() map[TopicPartition]int64 {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	out := make(map[TopicPartition]int64)
+	for tp, partition := range this.partitions {
+		if partition.watermark > partition.committed {
+			out[tp] = partition.watermark
+		}
+	}
+	return out
+}
+
+// MarkCommitted records the watermarks that were successfully committed to kafka.
+func (this *OffsetTracker) MarkCommitted(offsets map[TopicPartition]int64) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for tp, offset := range offsets {
+		if partition, found := this.partitions[tp]; found && offset > partition.committed {
+			partition.committed = offset
+		}
+	}
+}
+
+// Progress returns the commit progress of every tracked partition.
+func (this *OffsetTracker) Progress() map[TopicPartition]PartitionProgress {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	out := make(map[TopicPartition]PartitionProgress, len(this.partitions))
+	for tp, partition := range this.partitions {
+		out[tp] = PartitionProgress{
+			Pending:   len(partition.pending),
+			Acked:     partition.acked,
+			Watermark: partition.watermark,
+			Committed: partition.committed,
+		}
+	}
+	return out
+}
+
+// Outstanding returns the number of tracked entries that are still holding back their
+// partition's watermark, both pending ones and acknowledged ones that aren't contiguous yet.
+func (this *OffsetTracker) Outstanding() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	count := 0
+	for _, partition := range this.partitions {
+		count += len(partition.queue)
+	}
+	return count
+}
+
+// Reset forgets everything that was tracked for the given partitions,
+// or for all the partitions if none is given.
+func (this *OffsetTracker) Reset(partitions ...TopicPartition) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if len(partitions) == 0 {
+		this.keys = make(map[string][]trackedOffset)
+		this.partitions = make(map[TopicPartition]*partitionOffsets)
+		return
+	}
+
+	reset := make(map[TopicPartition]bool, len(partitions))
+	for _, tp := range partitions {
+		reset[tp] = true
+		delete(this.partitions, tp)
+	}
+	for key, tracked := range this.keys {
+		kept := tracked[:0]
+		for _, offset := range tracked {
+			if !reset[offset.tp] {
+				kept = append(kept, offset)
+			}
+		}
+		if len(kept) == 0 {
+			delete(this.keys, key)
+		} else {
+			this.keys[key] = kept
+		}
+	}
+}
+
+// earliest removes and returns the first message tracked under the key, must be called while holding the mutex.
+func (this *OffsetTracker) earliest(key string) (trackedOffset, bool) {
+	tracked := this.keys[key]
+	if len(tracked) == 0 {
+		return trackedOffset{}, false
+	}
+	if len(tracked) == 1 {
+		delete(this.keys, key)
+	} else {
+		this.keys[key] = tracked[1:]
+	}
+	return tracked[0], true
+}
+
+// latest removes and returns the last message tracked under the key, must be called while holding the mutex.
+func (this *OffsetTracker) latest(key string) (trackedOffset, bool) {
+	tracked := this.keys[key]
+	if len(tracked) == 0 {
+		return trackedOffset{}, false
+	}
+	if len(tracked) == 1 {
+		delete(this.keys, key)
+	} else {
+		this.keys[key] = tracked[:len(tracked)-1]
+	}
+	return tracked[len(tracked)-1], true
+}
+
+func (this *OffsetTracker) partition(tp TopicPartition) *partitionOffsets {
+	partition, found := this.partitions[tp]
+	if !found {
+		partition = &partitionOffsets{pending: make(map[int64]bool), watermark: -1, committed: -1}
+		this.partitions[tp] = partition
+	}
+	return partition
+}
+
+// advance pops the acknowledged offsets from the head of the partition's queue,
+// must be called while holding the mutex.
+func (this *OffsetTracker) advance(partition *partitionOffsets) {
+	for len(partition.queue) > 0 {
+		offset := partition.queue[0]
+		if partition.pending[offset] {
+			return
+		}
+		partition.queue = partition.queue[1:]
+		partition.acked--
+		partition.watermark = offset + 1
+	}
+}
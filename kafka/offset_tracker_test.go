@@ -0,0 +1,209 @@
+package kafka
+
+import (
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOffsetTracker_ContiguousWatermark(t *testing.T) {
+	tracker := NewOffsetTracker()
+	messages := []k.Message{
+		{Topic: "t", Partition: 0, Offset: 0, Key: []byte("a")},
+		{Topic: "t", Partition: 0, Offset: 1, Key: []byte("b")},
+		{Topic: "t", Partition: 0, Offset: 3, Key: []byte("c")},
+	}
+	for _, m := range messages {
+		tracker.Track(MessageKey(m), m)
+	}
+
+	tp := TopicPartition{Topic: "t", Partition: 0}
+
+	tracker.Ack(MessageKey(messages[1]), MessageKey(messages[2]))
+	assert.Empty(t, tracker.Committable())
+	assert.EqualValues(t, PartitionProgress{Pending: 1, Acked: 2, Watermark: -1, Committed: -1}, tracker.Progress()[tp])
+
+	tracker.Ack(MessageKey(messages[0]))
+	assert.EqualValues(t, map[TopicPartition]int64{tp: 4}, tracker.Committable())
+	assert.EqualValues(t, 0, tracker.Outstanding())
+
+	tracker.MarkCommitted(tracker.Committable())
+	assert.Empty(t, tracker.Committable())
+	assert.EqualValues(t, 4, tracker.Progress()[tp].Committed)
+}
+
+func TestOffsetTracker_PartitionsAreIndependent(t *testing.T) {
+	tracker := NewOffsetTracker()
+	m1 := k.Message{Topic: "t", Partition: 0, Offset: 5, Key: []byte("a")}
+	m2 := k.Message{Topic: "t", Partition: 1, Offset: 5, Key: []byte("b")}
+	tracker.Track(MessageKey(m1), m1)
+	tracker.Track(MessageKey(m2), m2)
+
+	tracker.Ack(MessageKey(m2))
+	assert.EqualValues(t, map[TopicPartition]int64{{Topic: "t", Partition: 1}: 6}, tracker.Committable())
+	assert.EqualValues(t, 1, tracker.Progress()[TopicPartition{Topic: "t", Partition: 0}].Pending)
+}
+
+func TestOffsetTracker_SharedKeys(t *testing.T) {
+	tracker := NewOffsetTracker()
+	m1 := k.Message{Topic: "t", Partition: 0, Offset: 5, Key: []byte("same"), Value: []byte("first")}
+	m2 := k.Message{Topic: "t", Partition: 1, Offset: 5, Key: []byte("same"), Value: []byte("second")}
+	m3 := k.Message{Topic: "t", Partition: 1, Offset: 6, Key: []byte("other")}
+	assert.EqualValues(t, MessageKey(m1), MessageKey(m2))
+	tracker.TrackBatch([]string{MessageKey(m1), MessageKey(m2), MessageKey(m3)}, []k.Message{m1, m2, m3})
+
+	// fetching a message again doesn't track it twice
+	tracker.Track(MessageKey(m1), m1)
+	assert.EqualValues(t, 3, tracker.Outstanding())
+
+	// the messages of a shared key are resolved in the order they were fetched
+	tracked, found := tracker.Message(MessageKey(m2))
+	assert.True(t, found)
+	assert.EqualValues(t, "first", tracked.Value)
+
+	tracker.Forget(MessageKey(m3))
+	tracker.Ack(MessageKey(m1))
+	assert.EqualValues(t, map[TopicPartition]int64{{Topic: "t", Partition: 0}: 6}, tracker.Committable())
+
+	tracker.Ack(MessageKey(m2))
+	assert.EqualValues(t, 6, tracker.Committable()[TopicPartition{Topic: "t", Partition: 1}])
+	assert.EqualValues(t, 0, tracker.Outstanding())
+}
+
+func TestOffsetTracker_Forget(t *testing.T) {
+	tracker := NewOffsetTracker()
+	m1 := k.Message{Topic: "t", Partition: 0, Offset: 0}
+	m2 := k.Message{Topic: "t", Partition: 0, Offset: 1}
+	tracker.Track(MessageKey(m1), m1)
+	tracker.Track(MessageKey(m2), m2)
+
+	tracker.Forget(MessageKey(m2))
+	tracker.Ack(MessageKey(m1))
+	assert.EqualValues(t, map[TopicPartition]int64{{Topic: "t", Partition: 0}: 1}, tracker.Committable())
+	assert.EqualValues(t, 0, tracker.Outstanding())
+}
+
+func TestOffsetTracker_TrackBatch(t *testing.T) {
+	tracker := NewOffsetTracker()
+	messages := []k.Message{
+		{Topic: "t", Partition: 0, Offset: 0},
+		{Topic: "t", Partition: 1, Offset: 0},
+		{Topic: "t", Partition: 0, Offset: 1},
+	}
+	keys := []string{MessageKey(messages[0]), MessageKey(messages[1]), MessageKey(messages[2])}
+	tracker.TrackBatch(keys, messages)
+	assert.EqualValues(t, 3, tracker.Outstanding())
+
+	tracker.Ack(keys...)
+	assert.EqualValues(t, map[TopicPartition]int64{
+		{Topic: "t", Partition: 0}: 2,
+		{Topic: "t", Partition: 1}: 1,
+	}, tracker.Committable())
+}
+
+func TestOffsetTracker_Message(t *testing.T) {
+	tracker := NewOffsetTracker()
+	m := k.Message{Topic: "t", Partition: 0, Offset: 3, Value: []byte("value")}
+	tracker.Track(MessageKey(m), m)
+
+	tracked, found := tracker.Message(MessageKey(m))
+	assert.True(t, found)
+	assert.EqualValues(t, m, tracked)
+
+	tracker.Ack(MessageKey(m))
+	_, found = tracker.Message(MessageKey(m))
+	assert.False(t, found)
+}
+
+func TestOffsetTracker_WithoutMessages(t *testing.T) {
+	tracker := newOffsetTracker(false)
+	m := k.Message{Topic: "t", Partition: 0, Offset: 3, Value: []byte("value")}
+	tracker.Track(MessageKey(m), m)
+
+	_, found := tracker.Message(MessageKey(m))
+	assert.False(t, found)
+	tracker.Ack(MessageKey(m))
+	assert.EqualValues(t, map[TopicPartition]int64{{Topic: "t", Partition: 0}: 4}, tracker.Committable())
+}
+
+func TestOffsetTracker_SourceWithoutCommits(t *testing.T) {
+	// a source that doesn't commit doesn't track what it delivers, so nothing piles up or holds back Stop
+	source := NewKafkaSource(NewSourceConfig([]string{"localhost:9092"}, "t", ""))
+	channel := make(s.EntryChannel, 1)
+	m := k.Message{Topic: "t", Partition: 0, Offset: 3, Value: []byte("value")}
+	assert.True(t, source.deliver([]k.Message{m}, channel, make(s.ErrorChannel, 1)))
+	assert.EqualValues(t, MessageKey(m), (<-channel).Key)
+	assert.EqualValues(t, 0, source.offsets.Outstanding())
+	assert.Nil(t, source.CommitEntry(MessageKey(m)))
+}
+
+// slowOffsetStore keeps the saved offsets in memory and delays the saves of the given offset,
+// so a concurrent commit can overtake it.
+type slowOffsetStore struct {
+	mutex   sync.Mutex
+	offsets map[TopicPartition]int64
+	slow    int64
+}
+
+func (this *slowOffsetStore) Load(partitions []TopicPartition) (map[TopicPartition]int64, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	out := make(map[TopicPartition]int64)
+	for _, tp := range partitions {
+		if offset, found := this.offsets[tp]; found {
+			out[tp] = offset
+		}
+	}
+	return out, nil
+}
+
+func (this *slowOffsetStore) Save(offsets map[TopicPartition]int64) error {
+	for _, offset := range offsets {
+		if offset == this.slow {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for tp, offset := range offsets {
+		this.offsets[tp] = offset
+	}
+	return nil
+}
+
+func TestCommitOrder_ConcurrentCommits(t *testing.T) {
+	commitTp := TopicPartition{Topic: "t", Partition: 0}
+	store := &slowOffsetStore{offsets: make(map[TopicPartition]int64), slow: 1}
+	cfg := NewSourceConfig([]string{"localhost:9092"}, "t", "")
+	cfg.OffsetStore = store
+	cfg.CommitIntervalMs = 0
+	source := NewKafkaSource(cfg)
+
+	session := newSourceSession(source, []string{"t"}, make(s.ErrorChannel, 10))
+	session.assigned[commitTp] = true
+	source.session = session
+
+	var keys []string
+	for offset := int64(0); offset < 2; offset++ {
+		m := k.Message{Topic: "t", Partition: 0, Offset: offset}
+		source.offsets.Track(MessageKey(m), m)
+		keys = append(keys, MessageKey(m))
+	}
+
+	first := make(chan error)
+	go func() {
+		first <- source.CommitEntry(keys[0])
+	}()
+	time.Sleep(20 * time.Millisecond)
+	assert.Nil(t, source.CommitEntry(keys[1]))
+	assert.Nil(t, <-first)
+
+	offsets, err := store.Load([]TopicPartition{commitTp})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, offsets[commitTp])
+}
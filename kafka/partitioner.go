@@ -0,0 +1,55 @@
+package kafka
+
+import (
+	"fmt"
+	k "github.com/segmentio/kafka-go"
+)
+
+// Partitioner selects how the kafka sink spreads the messages of a topic across its partitions.
+type Partitioner string
+
+const (
+	// Murmur2Partitioner hashes the message key with murmur2, like the java producer does.
+	Murmur2Partitioner Partitioner = "murmur2"
+
+	// FNVPartitioner hashes the message key with FNV-1a, like the sarama producer does.
+	FNVPartitioner Partitioner = "fnv"
+
+	// CRC32Partitioner hashes the message key with CRC32, like librdkafka does.
+	CRC32Partitioner Partitioner = "crc32"
+
+	// RoundRobinPartitioner ignores the message key and writes to every partition in turn.
+	RoundRobinPartitioner Partitioner = "round_robin"
+
+	// LeastBytesPartitioner ignores the message key and writes to the partition that received the least data.
+	LeastBytesPartitioner Partitioner = "least_bytes"
+)
+
+// PartitionFunc returns the partition a message should be written to out of the topic's partitions,
+// the message is given as a Record holding its key, serialized value, headers and topic.
+type PartitionFunc func(record Record, partitions []int) int
+
+// newBalancer creates the balancer of a single topic's writer, balancers can't be shared
+// between writers since some of them keep per partition state.
+func newBalancer(partitioner Partitioner, fn PartitionFunc) (k.Balancer, error) {
+	if fn != nil {
+		return k.BalancerFunc(func(m k.Message, partitions ...int) int {
+			return fn(NewRecord(m), partitions)
+		}), nil
+	}
+
+	switch partitioner {
+	case "", Murmur2Partitioner:
+		return k.Murmur2Balancer{}, nil
+	case FNVPartitioner:
+		return &k.Hash{}, nil
+	case CRC32Partitioner:
+		return k.CRC32Balancer{}, nil
+	case RoundRobinPartitioner:
+		return &k.RoundRobin{}, nil
+	case LeastBytesPartitioner:
+		return &k.LeastBytes{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported kafka partitioner '%s'", partitioner)
+	}
+}
@@ -0,0 +1,58 @@
+package kafka
+
+import (
+	k "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPartitioner_Hashing(t *testing.T) {
+	partitions := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	for _, partitioner := range []Partitioner{Murmur2Partitioner, FNVPartitioner, CRC32Partitioner} {
+		balancer, err := newBalancer(partitioner, nil)
+		assert.Nil(t, err)
+
+		m := k.Message{Key: []byte("tenant-1"), Value: []byte("value")}
+		first := balancer.Balance(m, partitions...)
+		assert.True(t, first >= 0 && first < len(partitions))
+		for i := 0; i < 10; i++ {
+			assert.EqualValues(t, first, balancer.Balance(m, partitions...), "partitioner %s", partitioner)
+		}
+	}
+}
+
+func TestPartitioner_RoundRobin(t *testing.T) {
+	balancer, err := newBalancer(RoundRobinPartitioner, nil)
+	assert.Nil(t, err)
+
+	used := make(map[int]bool)
+	for i := 0; i < 3; i++ {
+		used[balancer.Balance(k.Message{Key: []byte("same key")}, 0, 1, 2)] = true
+	}
+	assert.Len(t, used, 3)
+}
+
+func TestPartitioner_Defaults(t *testing.T) {
+	assert.EqualValues(t, Murmur2Partitioner, NewSinkConfig([]string{"localhost:9092"}, "topic").Partitioner)
+
+	balancer, err := newBalancer("", nil)
+	assert.Nil(t, err)
+	assert.IsType(t, k.Murmur2Balancer{}, balancer)
+
+	_, err = newBalancer("random", nil)
+	assert.NotNil(t, err)
+}
+
+func TestPartitioner_Func(t *testing.T) {
+	balancer, err := newBalancer(RoundRobinPartitioner, func(record Record, partitions []int) int {
+		if string(record.Header("tenant")) == "vip" {
+			return partitions[0]
+		}
+		return partitions[len(partitions)-1]
+	})
+	assert.Nil(t, err)
+
+	vip := k.Message{Headers: []k.Header{{Key: "tenant", Value: []byte("vip")}}}
+	assert.EqualValues(t, 0, balancer.Balance(vip, 0, 1, 2))
+	assert.EqualValues(t, 2, balancer.Balance(k.Message{}, 0, 1, 2))
+}
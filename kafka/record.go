@@ -0,0 +1,49 @@
+package kafka
+
+import (
+	k "github.com/segmentio/kafka-go"
+	"time"
+)
+
+// Record is a connector neutral representation of a kafka message, it lets the downstream stages
+// route on headers and event time without importing kafka-go.
+type Record struct {
+	Key   []byte
+	Value []byte
+
+	// Headers maps every header key to its value, when a key appears more than once the last value wins.
+	Headers map[string][]byte
+
+	Topic     string
+	Partition int
+	Offset    int64
+
+	// Timestamp is the time the message was produced at (or appended to the log, depending on the topic's configuration).
+	Timestamp time.Time
+}
+
+// NewRecord converts a kafka message into a Record.
+func NewRecord(m k.Message) Record {
+	var headers map[string][]byte
+	if len(m.Headers) > 0 {
+		headers = make(map[string][]byte, len(m.Headers))
+		for _, header := range m.Headers {
+			headers[header.Key] = header.Value
+		}
+	}
+
+	return Record{
+		Key:       m.Key,
+		Value:     m.Value,
+		Headers:   headers,
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Timestamp: m.Time,
+	}
+}
+
+// Header returns the value of the given header, or nil if the record doesn't have it.
+func (this Record) Header(key string) []byte {
+	return this.Headers[key]
+}
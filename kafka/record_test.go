@@ -0,0 +1,42 @@
+package kafka
+
+import (
+	k "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRecord_FromMessage(t *testing.T) {
+	now := time.Now()
+	m := k.Message{
+		Topic:     "topic",
+		Partition: 2,
+		Offset:    17,
+		Key:       []byte("key"),
+		Value:     []byte("value"),
+		Headers:   []k.Header{{Key: "type", Value: []byte("a")}, {Key: "type", Value: []byte("b")}, {Key: "trace", Value: []byte("1")}},
+		Time:      now,
+	}
+
+	entry := RecordEntryFunc(m)
+	assert.EqualValues(t, "17-key", entry.Key)
+
+	record := entry.Value.(Record)
+	assert.EqualValues(t, "topic", record.Topic)
+	assert.EqualValues(t, 2, record.Partition)
+	assert.EqualValues(t, 17, record.Offset)
+	assert.EqualValues(t, "key", record.Key)
+	assert.EqualValues(t, "value", record.Value)
+	assert.EqualValues(t, now, record.Timestamp)
+	assert.Len(t, record.Headers, 2)
+	assert.EqualValues(t, "b", record.Header("type"))
+	assert.EqualValues(t, "1", record.Header("trace"))
+	assert.Nil(t, record.Header("missing"))
+}
+
+func TestRecord_WithoutHeaders(t *testing.T) {
+	record := NewRecord(k.Message{Topic: "topic", Value: []byte("value")})
+	assert.Nil(t, record.Headers)
+	assert.Nil(t, record.Header("type"))
+}
@@ -0,0 +1,113 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	k "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"io/ioutil"
+	"time"
+)
+
+// TLSConfig enables TLS connections to the kafka brokers.
+type TLSConfig struct {
+	// CAFile is the path of a PEM encoded CA bundle used to verify the brokers,
+	// the system's root CAs are used when it's empty.
+	CAFile string
+
+	// CertFile and KeyFile are the paths of a PEM encoded client certificate and its private key,
+	// both are required when the brokers authenticate their clients by certificate.
+	CertFile string
+	KeyFile  string
+
+	// InsecureSkipVerify disables the verification of the brokers' certificates, use it only for testing.
+	InsecureSkipVerify bool
+}
+
+type SASLMechanism string
+
+const (
+	SASLPlain       SASLMechanism = "PLAIN"
+	SASLScramSHA256 SASLMechanism = "SCRAM-SHA-256"
+	SASLScramSHA512 SASLMechanism = "SCRAM-SHA-512"
+)
+
+// SASLConfig enables SASL authentication against the kafka brokers.
+type SASLConfig struct {
+	Mechanism SASLMechanism
+	Username  string
+	Password  string
+}
+
+// newDialer creates the dialer that is used for every connection to kafka (readers, writers, consumer groups
+// and pings), both configs are optional and a plain TCP dialer is returned when neither is set.
+func newDialer(tlsConfig *TLSConfig, saslConfig *SASLConfig) (*k.Dialer, error) {
+	dialer := &k.Dialer{
+		Timeout:   10 * time.Second,
+		DualStack: true,
+	}
+
+	if tlsConfig != nil {
+		config, err := tlsConfig.build()
+		if err != nil {
+			return nil, err
+		}
+		dialer.TLS = config
+	}
+
+	if saslConfig != nil {
+		mechanism, err := saslConfig.build()
+		if err != nil {
+			return nil, err
+		}
+		dialer.SASLMechanism = mechanism
+	}
+
+	return dialer, nil
+}
+
+func (this TLSConfig) build() (*tls.Config, error) {
+	out := &tls.Config{InsecureSkipVerify: this.InsecureSkipVerify}
+
+	if this.CAFile != "" {
+		pem, err := ioutil.ReadFile(this.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the kafka CA file: %s", err.Error())
+		}
+		out.RootCAs = x509.NewCertPool()
+		if !out.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("the kafka CA file '%s' doesn't contain any PEM encoded certificate", this.CAFile)
+		}
+	}
+
+	if this.CertFile != "" || this.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(this.CertFile, this.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the kafka client certificate: %s", err.Error())
+		}
+		out.Certificates = []tls.Certificate{cert}
+	}
+
+	return out, nil
+}
+
+func (this SASLConfig) build() (sasl.Mechanism, error) {
+	switch this.Mechanism {
+	case SASLPlain:
+		return plain.Mechanism{Username: this.Username, Password: this.Password}, nil
+	case SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, this.Username, this.Password)
+	case SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, this.Username, this.Password)
+	default:
+		return nil, fmt.Errorf("unsupported kafka SASL mechanism '%s'", this.Mechanism)
+	}
+}
+
+// String hides the password, since the source and the sink log their configs.
+func (this SASLConfig) String() string {
+	return fmt.Sprintf("{Mechanism:%s Username:%s Password:***}", this.Mechanism, this.Username)
+}
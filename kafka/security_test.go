@@ -0,0 +1,56 @@
+package kafka
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecurity_PlainDialer(t *testing.T) {
+	dialer, err := newDialer(nil, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, dialer.TLS)
+	assert.Nil(t, dialer.SASLMechanism)
+}
+
+func TestSecurity_SASLMechanisms(t *testing.T) {
+	for _, mechanism := range []SASLMechanism{SASLPlain, SASLScramSHA256, SASLScramSHA512} {
+		dialer, err := newDialer(nil, &SASLConfig{Mechanism: mechanism, Username: "user", Password: "secret"})
+		assert.Nil(t, err)
+		assert.EqualValues(t, mechanism, dialer.SASLMechanism.Name())
+	}
+
+	_, err := newDialer(nil, &SASLConfig{Mechanism: "GSSAPI", Username: "user", Password: "secret"})
+	assert.NotNil(t, err)
+}
+
+func TestSecurity_SASLPasswordIsHidden(t *testing.T) {
+	cfg := NewSinkConfig([]string{"localhost:9092"}, "topic")
+	cfg.SASL = &SASLConfig{Mechanism: SASLPlain, Username: "user", Password: "secret"}
+	assert.NotContains(t, fmt.Sprintf("%+v", cfg), "secret")
+}
+
+func TestSecurity_TLS(t *testing.T) {
+	dialer, err := newDialer(&TLSConfig{InsecureSkipVerify: true}, nil)
+	assert.Nil(t, err)
+	assert.True(t, dialer.TLS.InsecureSkipVerify)
+	assert.Nil(t, dialer.TLS.RootCAs)
+
+	_, err = newDialer(&TLSConfig{CAFile: "/does/not/exist.pem"}, nil)
+	assert.NotNil(t, err)
+
+	dir, err := ioutil.TempDir("", "kafka_tls")
+	panicOnErr(err)
+	defer os.RemoveAll(dir)
+
+	invalid := filepath.Join(dir, "invalid.pem")
+	panicOnErr(ioutil.WriteFile(invalid, []byte("not a certificate"), 0600))
+	_, err = newDialer(&TLSConfig{CAFile: invalid}, nil)
+	assert.NotNil(t, err)
+
+	_, err = newDialer(&TLSConfig{CertFile: invalid, KeyFile: invalid}, nil)
+	assert.NotNil(t, err)
+}
@@ -14,7 +14,7 @@ import (
 var source *kafkaSource
 var sink *kafkaSink
 var sinkSourceTopic *kafkaSink
-var errs go_streams.ErrorChannel
+var errs = make(go_streams.ErrorChannel, 1000)
 var ch = make(go_streams.EntryChannel, 1000)
 
 func TestMain(m *testing.M) {
@@ -49,9 +49,13 @@ func TestMain(m *testing.M) {
 }
 
 func readN(n int) []kafka.Message {
+	return readTopic("test_sink", n)
+}
+
+func readTopic(topic string, n int) []kafka.Message {
 	r := kafka.NewReader(kafka.ReaderConfig{
 		Brokers: []string{"localhost:9092"},
-		Topic:   "test_sink",
+		Topic:   topic,
 	})
 	var out []kafka.Message
 	for i := 0; i < n; i++ {
@@ -62,6 +66,47 @@ func readN(n int) []kafka.Message {
 	return out
 }
 
+// readWithin reads the first n messages of the topic, it fails the test if they can't be read in time.
+func readWithin(t *testing.T, topic string, n int, timeout time.Duration) []kafka.Message {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{"localhost:9092"},
+		Topic:   topic,
+	})
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var out []kafka.Message
+	for i := 0; i < n; i++ {
+		m, err := r.ReadMessage(ctx)
+		if err != nil {
+			t.Fatalf("failed to read %d messages from %s: %s", n, topic, err.Error())
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// startSource creates a source with the given config and starts it, the caller stops it.
+func startSource(t *testing.T, cfg SourceConfig) (*kafkaSource, go_streams.EntryChannel) {
+	source := NewKafkaSource(cfg)
+	entries := make(go_streams.EntryChannel, 10)
+	go source.Start(entries, make(go_streams.ErrorChannel, 100))
+	return source, entries
+}
+
+// nextEntry returns the next entry of the source, it fails the test if none arrives in time.
+func nextEntry(t *testing.T, entries go_streams.EntryChannel) go_streams.Entry {
+	select {
+	case e := <-entries:
+		return e
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout while waiting for an entry")
+	}
+	return go_streams.Entry{}
+}
+
 func startKafka() {
 	panicOrPrint(run("docker rm --force snkafka_test || true"))
 	panicOrPrint(run("docker run -d -p 2181:2181 -p 3030:3030 -p 8081-8083:8081-8083 -p 9581-9585:9581-9585 -p 9092:9092 -e ADV_HOST=localhost --name snkafka_test landoop/fast-data-dev:latest"))
@@ -5,14 +5,43 @@ import (
 	"fmt"
 	s "github.com/matang28/go-streams"
 	k "github.com/segmentio/kafka-go"
+	"sort"
+	"sync"
 	"time"
 )
 
+// maxMessageBytes is the writer's default BatchBytes, it refuses to write any larger message.
+const maxMessageBytes = 1048576
+
 type kafkaSink struct {
 	cfg SinkConfig
 
-	writer *k.Writer
-	conn   *k.Conn
+	dialer *k.Dialer
+	health *HealthChecker
+	admin  *kafkaAdmin
+
+	// writers holds a writer per topic, they're created the first time an entry is routed to their topic.
+	mutex   sync.Mutex
+	writers map[string]*k.Writer
+
+	// dedup remembers the deduplication keys that were written in the idempotent mode.
+	dedup *dedupWindow
+
+	// deliveries queues the entries that are written asynchronously when delivery reports are enabled,
+	// pending counts the queued entries whose outcome wasn't reported yet.
+	deliveries   chan s.Entry
+	pending      int
+	pendingMutex sync.Mutex
+	delivered    *sync.Cond
+
+	// every write holds a read lock, Flush and Close take the write lock so they wait for the
+	// writes in progress and block new ones. closed is set atomically as soon as Close is called,
+	// so the writes fail right away instead of waiting for a Close that may never finish.
+	lifecycle sync.RWMutex
+	closed    int32
+	closeOnce sync.Once
+	closeDone chan struct{}
+	closeErr  error
 
 	extractor s.KeyExtractor
 }
@@ -30,73 +59,279 @@ func NewKafkaSink(cfg SinkConfig, extractor s.KeyExtractor) *kafkaSink {
 		}
 	}
 
-	out := &kafkaSink{cfg: cfg, extractor: extractor}
+	dialer, err := newDialer(cfg.TLS, cfg.SASL)
+	if err != nil {
+		panic(err)
+	}
+
+	// fail fast on an unsupported partitioner, every writer creates its own balancer later on
+	if _, err := newBalancer(cfg.Partitioner, cfg.PartitionFunc); err != nil {
+		panic(err)
+	}
+
+	if _, err := newCompressionCodec(cfg.Compression); err != nil {
+		panic(err)
+	}
+
+	out := &kafkaSink{
+		cfg:       cfg,
+		dialer:    dialer,
+		health:    newHealthChecker(cfg.Hosts, dialer),
+		admin:     newKafkaAdmin(cfg.Hosts, dialer),
+		writers:   make(map[string]*k.Writer),
+		extractor: extractor,
+	}
+	out.delivered = sync.NewCond(&out.pendingMutex)
+	if cfg.DedupKeyExtractor != nil {
+		out.dedup = newDedupWindow(cfg.DedupWindowSize)
+	}
 	s.Log().Info("Connecting to kafka with config: %+v", cfg)
 	if err := out.connect(); err != nil {
 		panic(err)
 	}
 	s.Log().Info("Connected to kafka with config: %+v", cfg)
+
+	if cfg.Async && cfg.OnDelivery != nil {
+		queueCapacity := cfg.AsyncQueueCapacity
+		if queueCapacity <= 0 {
+			queueCapacity = defaultAsyncQueueCapacity
+		}
+		out.deliveries = make(chan s.Entry, queueCapacity)
+		go out.deliverAsync()
+	}
 	return out
 }
 
 func (this *kafkaSink) Single(entry s.Entry) error {
-	return this.writer.WriteMessages(context.Background(), k.Message{
-		Key:   []byte(this.extractor(entry)),
-		Value: this.cfg.Serializer(entry),
-	})
+	if this.isClosed() {
+		return errSinkClosed
+	}
+	this.lifecycle.RLock()
+	defer this.lifecycle.RUnlock()
+	if this.isClosed() {
+		return errSinkClosed
+	}
+
+	if this.deliveries != nil {
+		this.enqueue(entry)
+		return nil
+	}
+
+	// written like a batch of one, so the idempotent mode covers single entries as well
+	return this.write([]s.Entry{entry}).Errors[entry.Key]
 }
 
+// Batch writes the entries of every topic with a single call to the topic's writer, the order of the entries
+// is kept within each topic. Failures are returned as a SinkBatchError that maps the entry keys to their errors,
+// a failed write fails every entry of its topic, so retrying them may duplicate entries that were delivered.
 func (this *kafkaSink) Batch(entry ...s.Entry) error {
-	messages := make([]k.Message, len(entry))
+	if this.isClosed() {
+		return errSinkClosed
+	}
+	this.lifecycle.RLock()
+	defer this.lifecycle.RUnlock()
+	if this.isClosed() {
+		return errSinkClosed
+	}
+
+	if this.deliveries != nil {
+		this.enqueue(entry...)
+		return nil
+	}
+	return this.write(entry).AsError()
+}
+
+// write writes the entries of every topic concurrently, a failed write is reported for every entry of its
+// topic (or for the single entry that couldn't be routed), even if some of them were already delivered.
+func (this *kafkaSink) write(entry []s.Entry) *s.SinkBatchError {
+	errs := s.NewSinkBatchError()
+
+	var topics []string
+	messages := make(map[string][]k.Message)
+	keys := make(map[string][]string)
+	dedupKeys := make(map[string][]string)
+	written := make(map[string]bool)
 	for idx := range entry {
-		messages[idx] = k.Message{
-			Key:   []byte(this.extractor(entry[idx])),
-			Value: this.cfg.Serializer(entry[idx]),
+		topic, err := this.topicOf(entry[idx])
+		if err != nil {
+			errs.Add(entry[idx].Key, err)
+			continue
+		}
+
+		var dedupKey string
+		if this.dedup != nil {
+			dedupKey = this.cfg.DedupKeyExtractor(entry[idx])
+			if _, found := this.dedup.lookup(dedupKey); found || written[dedupKey] {
+				// the entry was already written, there's nothing to do
+				continue
+			}
+			written[dedupKey] = true
+		}
+
+		m := this.newMessage(entry[idx])
+		if messageSize(m) > maxMessageBytes {
+			// the writer would give up on the rest of the batch as well
+			errs.Add(entry[idx].Key, k.MessageSizeTooLarge)
+			continue
+		}
+
+		if _, found := messages[topic]; !found {
+			topics = append(topics, topic)
+		}
+		messages[topic] = append(messages[topic], m)
+		keys[topic] = append(keys[topic], entry[idx].Key)
+		dedupKeys[topic] = append(dedupKeys[topic], dedupKey)
+	}
+
+	type topicResult struct {
+		topic string
+		err   error
+	}
+	results := make(chan topicResult, len(topics))
+	for _, topic := range topics {
+		go func(topic string) {
+			writer, err := this.writerOf(topic)
+			if err == nil {
+				err = writer.WriteMessages(context.Background(), messages[topic]...)
+			}
+			results <- topicResult{topic: topic, err: err}
+		}(topic)
+	}
+
+	for range topics {
+		result := <-results
+		for _, key := range keys[result.topic] {
+			errs.Add(key, result.err)
+		}
+		if result.err == nil && this.dedup != nil {
+			for _, key := range dedupKeys[result.topic] {
+				this.dedup.add(key, messagePosition{})
+			}
 		}
 	}
-	return this.writer.WriteMessages(context.Background(), messages...)
+	return errs
 }
 
-func (this *kafkaSink) Ping() error {
-	var err error
+// messageSize returns the size the writer accounts for a message, see kafka-go's Message.size.
+func messageSize(m k.Message) int {
+	return 4 + 1 + 1 + 4 + len(m.Key) + 4 + len(m.Value) + 8
+}
+
+func (this *kafkaSink) newMessage(entry s.Entry) k.Message {
+	out := k.Message{
+		Key:   []byte(this.extractor(entry)),
+		Value: this.cfg.Serializer(entry),
+	}
 
-	if this.conn == nil {
-		for _, host := range this.cfg.Hosts {
-			this.conn, err = k.Dial("tcp", host)
-			if err != nil {
+	if this.cfg.HeadersExtractor != nil {
+		headers := this.cfg.HeadersExtractor(entry)
+		keys := make([]string, 0, len(headers))
+		for key := range headers {
+			keys = append(keys, key)
+		}
+		// keep the headers order deterministic
+		sort.Strings(keys)
+		for _, key := range keys {
+			if key == DedupHeader && this.cfg.DedupKeyExtractor != nil {
+				// the deduplication key of the idempotent mode takes precedence
 				continue
 			}
+			out.Headers = append(out.Headers, k.Header{Key: key, Value: headers[key]})
 		}
 	}
-	if err != nil {
-		return err
+
+	if this.cfg.DedupKeyExtractor != nil {
+		out.Headers = append(out.Headers, k.Header{Key: DedupHeader, Value: []byte(this.cfg.DedupKeyExtractor(entry))})
 	}
 
-	brokers, err := this.conn.Brokers()
-	if err != nil {
-		return err
+	if this.cfg.TimestampExtractor != nil {
+		out.Time = this.cfg.TimestampExtractor(entry)
 	}
+	return out
+}
 
-	if len(brokers) <= 0 {
-		return fmt.Errorf("failed to get a valid list of kafka brokers")
+// topicOf returns the topic the entry should be written to, entries that the TopicExtractor
+// doesn't route anywhere are written to the configured Topic.
+func (this *kafkaSink) topicOf(entry s.Entry) (string, error) {
+	topic := this.cfg.Topic
+	if this.cfg.TopicExtractor != nil {
+		if routed := this.cfg.TopicExtractor(entry); routed != "" {
+			topic = routed
+		}
+	}
+
+	if topic == "" {
+		return "", fmt.Errorf("no kafka topic to write entry '%s' to", entry.Key)
 	}
+	return topic, nil
+}
+
+// writerOf returns the writer of the given topic, creating it if needed, when the sink is configured
+// with AutoCreateTopic the topic is created before its writer.
+func (this *kafkaSink) writerOf(topic string) (*k.Writer, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	writer, found := this.writers[topic]
+	if !found {
+		if this.cfg.AutoCreateTopic {
+			spec := this.cfg.AutoCreateSpec
+			spec.Topic = topic
+			if err := this.admin.EnsureTopic(spec); err != nil {
+				return nil, err
+			}
+		}
+
+		balancer, _ := newBalancer(this.cfg.Partitioner, this.cfg.PartitionFunc)
+		codec, _ := newCompressionCodec(this.cfg.Compression)
+		writer = k.NewWriter(k.WriterConfig{
+			Brokers:           this.cfg.Hosts,
+			Topic:             topic,
+			Dialer:            this.dialer,
+			Balancer:          balancer,
+			CompressionCodec:  codec,
+			MaxAttempts:       this.cfg.MaxRetries,
+			BatchSize:         this.cfg.BatchSize,
+			BatchTimeout:      time.Duration(this.cfg.BatchTimeoutSeconds) * time.Second,
+			WriteTimeout:      time.Duration(this.cfg.WriteTimeoutSeconds) * time.Second,
+			RebalanceInterval: time.Duration(this.cfg.RebalanceTimeoutSeconds) * time.Second,
+			RequiredAcks:      this.cfg.RequiredAcks,
+			Async:             this.cfg.Async && this.cfg.OnDelivery == nil,
+		})
+		this.writers[topic] = writer
+	}
+	return writer, nil
+}
 
+// Ping succeeds when at least one of the kafka hosts is reachable, see HealthChecker.Check.
+func (this *kafkaSink) Ping() error {
+	report := this.Health()
+	if err := report.Err(); err != nil {
+		return err
+	}
+	if len(report.MissingTopics) > 0 {
+		s.Log().Warn("Kafka sink topics %v don't exist yet", report.MissingTopics)
+	}
 	return nil
 }
 
-func (this *kafkaSink) connect() error {
-	this.writer = k.NewWriter(k.WriterConfig{
-		Brokers:           this.cfg.Hosts,
-		Topic:             this.cfg.Topic,
-		Balancer:          k.Murmur2Balancer{},
-		MaxAttempts:       this.cfg.MaxRetries,
-		BatchSize:         this.cfg.BatchSize,
-		BatchTimeout:      time.Duration(this.cfg.BatchTimeoutSeconds) * time.Second,
-		WriteTimeout:      time.Duration(this.cfg.WriteTimeoutSeconds) * time.Second,
-		RebalanceInterval: time.Duration(this.cfg.RebalanceTimeoutSeconds) * time.Second,
-		RequiredAcks:      this.cfg.RequiredAcks,
-		Async:             this.cfg.Async,
-	})
+// Health probes all the configured hosts and checks that the configured topic,
+// as well as every topic an entry was routed to, exist.
+func (this *kafkaSink) Health() HealthReport {
+	this.mutex.Lock()
+	topics := make([]string, 0, len(this.writers))
+	for topic := range this.writers {
+		topics = append(topics, topic)
+	}
+	this.mutex.Unlock()
+	return this.health.Check(topics...)
+}
 
+func (this *kafkaSink) connect() error {
+	if this.cfg.Topic != "" {
+		if _, err := this.writerOf(this.cfg.Topic); err != nil {
+			return err
+		}
+	}
 	return this.Ping()
 }
@@ -1,11 +1,20 @@
 package kafka
 
-import go_streams "github.com/matang28/go-streams"
+import (
+	go_streams "github.com/matang28/go-streams"
+	"time"
+)
 
 type SinkConfig struct {
 	Hosts []string
 	Topic string
 
+	// TLS optionally enables TLS connections to the brokers.
+	TLS *TLSConfig
+
+	// SASL optionally enables SASL authentication (PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512).
+	SASL *SASLConfig
+
 	// Limit on how many attempts will be made to deliver a message.
 	MaxRetries int
 
@@ -32,11 +41,73 @@ type SinkConfig struct {
 
 	// Setting this flag to true causes the WriteMessages method to never block.
 	// It also means that errors are ignored since the caller will not receive
-	// the returned value. Use this only if you don't care about guarantees of
-	// whether the messages were written to kafka.
+	// the returned value, unless OnDelivery is set. Use this only if you don't
+	// care about guarantees of whether the messages were written to kafka.
 	Async bool
 
+	// OnDelivery is optionally called with the outcome of every entry that was written asynchronously,
+	// e.g. to commit the upstream source only once the entry was delivered. Only used when Async is set.
+	OnDelivery func(report DeliveryReport)
+
+	// AsyncQueueCapacity limits how many entries may wait to be written asynchronously,
+	// Single and Batch block once the queue is full.
+	//
+	// Default: 1000
+	//
+	// Only used when Async and OnDelivery are set.
+	AsyncQueueCapacity int
+
+	// CloseTimeout limits how long Close waits for the buffered entries to be written.
+	//
+	// Default: 10s
+	CloseTimeoutSec int
+
+	// Partitioner selects how the messages are spread across the partitions of their topic.
+	//
+	// Default: Murmur2Partitioner
+	Partitioner Partitioner
+
+	// Compression optionally compresses the message batches with one of gzip, snappy, lz4 or zstd,
+	// zstd requires building with cgo.
+	//
+	// Default: NoCompression
+	Compression Compression
+
+	// PartitionFunc optionally picks the partition of every message, it takes precedence over Partitioner.
+	PartitionFunc PartitionFunc
+
 	Serializer func(entry go_streams.Entry) []byte
+
+	// AutoCreateTopic creates the Topic, as well as every topic an entry is routed to, if it doesn't exist yet
+	// using the partitions, replication factor and config of AutoCreateSpec (its Topic is ignored).
+	AutoCreateTopic bool
+	AutoCreateSpec  TopicSpec
+
+	// DedupKeyExtractor enables the idempotent mode, every message carries the deduplication key it returns
+	// in its DedupHeader so a source configured with a DedupWindowSize drops the duplicates that the retries
+	// produce. The sink also skips the entries whose deduplication key it has written among its last
+	// DedupWindowSize entries, e.g. entries that an upstream source has redelivered.
+	DedupKeyExtractor func(entry go_streams.Entry) string
+
+	// DedupWindowSize sets how many deduplication keys the sink remembers.
+	//
+	// Default: 10000
+	//
+	// Only used when DedupKeyExtractor is set.
+	DedupWindowSize int
+
+	// TopicExtractor optionally routes every entry to its own topic (e.g. by tenant or event type),
+	// entries it returns an empty topic for are written to Topic.
+	// The sink creates a writer for every topic the first time an entry is routed to it.
+	TopicExtractor func(entry go_streams.Entry) string
+
+	// HeadersExtractor optionally sets the headers of every message (e.g. trace ids or schema versions),
+	// notice that headers require kafka 0.11 or newer.
+	HeadersExtractor func(entry go_streams.Entry) map[string][]byte
+
+	// TimestampExtractor optionally sets the timestamp of every message (e.g. the event time),
+	// messages it returns a zero time for are stamped with the time they were written at.
+	TimestampExtractor func(entry go_streams.Entry) time.Time
 }
 
 func NewSinkConfig(hosts []string, topic string) SinkConfig {
@@ -50,5 +121,9 @@ func NewSinkConfig(hosts []string, topic string) SinkConfig {
 	out.RebalanceTimeoutSeconds = 15
 	out.RequiredAcks = -1
 	out.Async = false
+	out.AsyncQueueCapacity = 1000
+	out.CloseTimeoutSec = 10
+	out.Partitioner = Murmur2Partitioner
+	out.DedupWindowSize = 10000
 	return out
 }
@@ -0,0 +1,74 @@
+package kafka
+
+import s "github.com/matang28/go-streams"
+
+const defaultAsyncQueueCapacity = 1000
+
+// DeliveryReport holds the outcome of an entry that was written asynchronously.
+type DeliveryReport struct {
+	// Key is the key of the written entry (not the key of the kafka message).
+	Key string
+
+	// Err is nil if the entry was delivered to kafka.
+	Err error
+}
+
+// deliverAsync writes the queued entries in the order they were queued, every round writes everything
+// that was queued since the previous round (up to BatchSize entries) and reports the outcome of each entry.
+func (this *kafkaSink) deliverAsync() {
+	for entry := range this.deliveries {
+		batch := []s.Entry{entry}
+	drain:
+		for len(batch) < this.cfg.BatchSize {
+			select {
+			case next, ok := <-this.deliveries:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, next)
+			default:
+				break drain
+			}
+		}
+
+		errs := this.write(batch)
+		if len(errs.Errors) > 0 {
+			s.Log().Warn("Failed to deliver %d out of %d entries to kafka asynchronously", len(errs.Errors), len(batch))
+		}
+		for idx := range batch {
+			this.cfg.OnDelivery(DeliveryReport{Key: batch[idx].Key, Err: errs.Errors[batch[idx].Key]})
+		}
+		this.markDelivered(len(batch))
+	}
+}
+
+// enqueue hands the entries to deliverAsync, it blocks while the queue is full.
+func (this *kafkaSink) enqueue(entries ...s.Entry) {
+	this.pendingMutex.Lock()
+	this.pending += len(entries)
+	this.pendingMutex.Unlock()
+
+	for idx := range entries {
+		this.deliveries <- entries[idx]
+	}
+}
+
+func (this *kafkaSink) markDelivered(count int) {
+	this.pendingMutex.Lock()
+	defer this.pendingMutex.Unlock()
+
+	this.pending -= count
+	if this.pending <= 0 {
+		this.delivered.Broadcast()
+	}
+}
+
+// awaitDeliveries blocks until the outcome of every queued entry was reported.
+func (this *kafkaSink) awaitDeliveries() {
+	this.pendingMutex.Lock()
+	defer this.pendingMutex.Unlock()
+
+	for this.pending > 0 {
+		this.delivered.Wait()
+	}
+}
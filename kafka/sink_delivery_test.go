@@ -0,0 +1,56 @@
+package kafka
+
+import (
+	"fmt"
+	s "github.com/matang28/go-streams"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestKafkaSink_DeliveryReports(t *testing.T) {
+	reports := make(chan DeliveryReport, 10)
+	cfg := NewSinkConfig([]string{"localhost:9092"}, "")
+	cfg.Async = true
+	cfg.OnDelivery = func(report DeliveryReport) {
+		reports <- report
+	}
+	cfg.TopicExtractor = func(entry s.Entry) string {
+		// entries that aren't routed anywhere fail since the sink has no default topic
+		if entry.Key == "unroutable" {
+			return ""
+		}
+		return "test_sink_delivery"
+	}
+	async := NewKafkaSink(cfg, nil)
+
+	assert.Nil(t, async.Batch(
+		s.Entry{Key: "entry0", Value: []byte("value 0")},
+		s.Entry{Key: "entry1", Value: []byte("value 1")},
+	))
+	assert.Nil(t, async.Single(s.Entry{Key: "entry2", Value: []byte("value 2")}))
+
+	for i := 0; i < 3; i++ {
+		select {
+		case report := <-reports:
+			assert.EqualValues(t, fmt.Sprintf("entry%d", i), report.Key)
+			assert.Nil(t, report.Err)
+		case <-time.After(30 * time.Second):
+			t.Fatal("timeout while waiting for delivery reports")
+		}
+	}
+
+	messages := readTopic("test_sink_delivery", 3)
+	for i := range messages {
+		assert.EqualValues(t, fmt.Sprintf("value %d", i), messages[i].Value)
+	}
+
+	assert.Nil(t, async.Single(s.Entry{Key: "unroutable", Value: []byte("value")}))
+	select {
+	case report := <-reports:
+		assert.EqualValues(t, "unroutable", report.Key)
+		assert.NotNil(t, report.Err)
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout while waiting for a failed delivery report")
+	}
+}
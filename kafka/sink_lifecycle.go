@@ -0,0 +1,90 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"sync/atomic"
+	"time"
+)
+
+const defaultSinkCloseTimeout = 10 * time.Second
+
+var errSinkClosed = errors.New("the kafka sink is closed")
+
+// Flush blocks until every entry that was handed to the sink so far was acknowledged by kafka (or failed),
+// including the entries that are written asynchronously. New writes wait for the flush to end.
+func (this *kafkaSink) Flush() error {
+	if this.isClosed() {
+		return errSinkClosed
+	}
+	this.lifecycle.Lock()
+	defer this.lifecycle.Unlock()
+
+	if this.isClosed() {
+		return errSinkClosed
+	}
+
+	this.awaitDeliveries()
+	if this.cfg.Async && this.cfg.OnDelivery == nil {
+		// an asynchronous writer only flushes its batches when it's closed,
+		// new writers are created on the next write.
+		return this.closeWriters()
+	}
+	return nil
+}
+
+// Close flushes the sink and releases its writers, it gives up on the buffered entries once the
+// CloseTimeout has passed. Every write after Close fails, calling Close again waits for the same close.
+func (this *kafkaSink) Close() error {
+	timeout := time.Duration(this.cfg.CloseTimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = defaultSinkCloseTimeout
+	}
+
+	this.closeOnce.Do(func() {
+		s.Log().Info("Closing kafka sink with config: %+v", this.cfg)
+		atomic.StoreInt32(&this.closed, 1)
+		this.closeDone = make(chan struct{})
+
+		go func() {
+			defer close(this.closeDone)
+			this.lifecycle.Lock()
+			defer this.lifecycle.Unlock()
+
+			this.awaitDeliveries()
+			if this.deliveries != nil {
+				close(this.deliveries)
+			}
+			this.closeErr = this.closeWriters()
+		}()
+	})
+
+	select {
+	case <-this.closeDone:
+		return this.closeErr
+	case <-time.After(timeout):
+		return fmt.Errorf("timeout after %s while closing the kafka sink, buffered entries may be lost", timeout)
+	}
+}
+
+func (this *kafkaSink) isClosed() bool {
+	return atomic.LoadInt32(&this.closed) == 1
+}
+
+// closeWriters closes all the writers, which flushes their buffered messages, and forgets about them.
+func (this *kafkaSink) closeWriters() error {
+	this.mutex.Lock()
+	writers := this.writers
+	this.writers = make(map[string]*k.Writer)
+	this.mutex.Unlock()
+
+	var out error
+	for topic, writer := range writers {
+		if err := writer.Close(); err != nil && out == nil {
+			out = fmt.Errorf("failed to close the kafka writer of topic '%s': %s", topic, err.Error())
+		}
+	}
+	return out
+}
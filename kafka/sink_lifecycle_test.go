@@ -0,0 +1,74 @@
+package kafka
+
+import (
+	"fmt"
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKafkaSink_Flush(t *testing.T) {
+	cfg := NewSinkConfig([]string{"localhost:9092"}, "test_sink_flush")
+	cfg.Async = true
+	cfg.BatchTimeoutSeconds = 60
+	buffered := NewKafkaSink(cfg, nil)
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, buffered.Single(s.Entry{Key: fmt.Sprintf("entry%d", i), Value: []byte("value")}))
+	}
+	assert.Nil(t, buffered.Flush())
+
+	// the batch timeout didn't pass yet, the messages are only there thanks to the flush
+	messages := readWithin(t, "test_sink_flush", 3, 10*time.Second)
+	assert.Len(t, messages, 3)
+
+	// the sink keeps on writing after a flush
+	assert.Nil(t, buffered.Single(s.Entry{Key: "entry3", Value: []byte("value")}))
+	assert.Nil(t, buffered.Close())
+	assert.Len(t, readWithin(t, "test_sink_flush", 4, 10*time.Second), 4)
+}
+
+func TestKafkaSink_Close(t *testing.T) {
+	reports := make(chan DeliveryReport, 10)
+	cfg := NewSinkConfig([]string{"localhost:9092"}, "test_sink_close")
+	cfg.Async = true
+	cfg.OnDelivery = func(report DeliveryReport) {
+		reports <- report
+	}
+	closed := NewKafkaSink(cfg, nil)
+
+	assert.Nil(t, closed.Batch(
+		s.Entry{Key: "entry0", Value: []byte("value 0")},
+		s.Entry{Key: "entry1", Value: []byte("value 1")},
+	))
+	assert.Nil(t, closed.Close())
+
+	// every queued entry was reported by the time Close returned
+	assert.Len(t, reports, 2)
+	assert.EqualValues(t, errSinkClosed, closed.Single(s.Entry{Key: "entry2", Value: []byte("value 2")}))
+	assert.EqualValues(t, errSinkClosed, closed.Flush())
+	assert.Nil(t, closed.Close())
+}
+
+func TestSinkLifecycle_CloseTimeout(t *testing.T) {
+	stuck := &kafkaSink{cfg: SinkConfig{CloseTimeoutSec: 1}, writers: make(map[string]*k.Writer)}
+	stuck.delivered = sync.NewCond(&stuck.pendingMutex)
+
+	// a write that never ends keeps Close from taking the lifecycle lock
+	stuck.lifecycle.RLock()
+	assert.NotNil(t, stuck.Close())
+
+	start := time.Now()
+	assert.Equal(t, errSinkClosed, stuck.Single(s.Entry{Key: "entry0"}))
+	assert.Equal(t, errSinkClosed, stuck.Batch(s.Entry{Key: "entry1"}))
+	assert.Equal(t, errSinkClosed, stuck.Flush())
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+
+	// once the write ends, the pending close completes and every call returns its result
+	stuck.lifecycle.RUnlock()
+	assert.Nil(t, stuck.Close())
+	assert.Nil(t, stuck.Close())
+}
@@ -2,8 +2,10 @@ package kafka
 
 import (
 	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestKafkaSink_Single(t *testing.T) {
@@ -47,3 +49,97 @@ func TestKafkaSink_Batch(t *testing.T) {
 	assert.EqualValues(t, entry3.Key, messages[2].Key)
 	assert.EqualValues(t, entry3.Value, messages[2].Value)
 }
+
+func TestKafkaSink_TopicExtractor(t *testing.T) {
+	cfg := NewSinkConfig([]string{"localhost:9092"}, "test_sink_routed_default")
+	cfg.TopicExtractor = func(entry s.Entry) string {
+		if entry.Key == "default" {
+			return ""
+		}
+		return "test_sink_routed_" + entry.Key
+	}
+	routed := NewKafkaSink(cfg, nil)
+
+	err := routed.Batch(
+		s.Entry{Key: "a", Value: []byte("a1")},
+		s.Entry{Key: "b", Value: []byte("b1")},
+		s.Entry{Key: "a", Value: []byte("a2")},
+		s.Entry{Key: "default", Value: []byte("default1")},
+	)
+	assert.Nil(t, err)
+
+	a := readTopic("test_sink_routed_a", 2)
+	assert.EqualValues(t, "a1", a[0].Value)
+	assert.EqualValues(t, "a2", a[1].Value)
+	assert.EqualValues(t, "b1", readTopic("test_sink_routed_b", 1)[0].Value)
+	assert.EqualValues(t, "default1", readTopic("test_sink_routed_default", 1)[0].Value)
+}
+
+func TestKafkaSink_NoTopic(t *testing.T) {
+	cfg := NewSinkConfig([]string{"localhost:9092"}, "")
+	cfg.TopicExtractor = func(entry s.Entry) string { return "" }
+	routed := NewKafkaSink(cfg, nil)
+
+	assert.NotNil(t, routed.Single(s.Entry{Key: "entry1", Value: []byte("value")}))
+}
+
+func TestKafkaSink_HeadersAndTimestamp(t *testing.T) {
+	eventTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	cfg := NewSinkConfig([]string{"localhost:9092"}, "test_sink_headers")
+	cfg.HeadersExtractor = func(entry s.Entry) map[string][]byte {
+		return map[string][]byte{"trace-id": []byte("trace-" + entry.Key), "schema": []byte("v2")}
+	}
+	cfg.TimestampExtractor = func(entry s.Entry) time.Time {
+		return eventTime
+	}
+	headers := NewKafkaSink(cfg, nil)
+
+	assert.Nil(t, headers.Single(s.Entry{Key: "entry1", Value: []byte("value")}))
+
+	record := NewRecord(readTopic("test_sink_headers", 1)[0])
+	assert.EqualValues(t, "trace-entry1", record.Header("trace-id"))
+	assert.EqualValues(t, "v2", record.Header("schema"))
+	assert.True(t, eventTime.Equal(record.Timestamp))
+}
+
+func TestSinkMessage_HeadersAreSorted(t *testing.T) {
+	cfg := NewSinkConfig([]string{"localhost:9092"}, "topic")
+	cfg.Serializer = func(entry s.Entry) []byte { return entry.Value.([]byte) }
+	cfg.HeadersExtractor = func(entry s.Entry) map[string][]byte {
+		return map[string][]byte{"c": []byte("3"), "a": []byte("1"), "b": []byte("2")}
+	}
+	unconnected := &kafkaSink{cfg: cfg, extractor: func(entry s.Entry) string { return entry.Key }}
+
+	m := unconnected.newMessage(s.Entry{Key: "entry1", Value: []byte("value")})
+	assert.EqualValues(t, "entry1", m.Key)
+	assert.True(t, m.Time.IsZero())
+	assert.EqualValues(t, []k.Header{{Key: "a", Value: []byte("1")}, {Key: "b", Value: []byte("2")}, {Key: "c", Value: []byte("3")}}, m.Headers)
+}
+
+func TestKafkaSink_BatchErrors(t *testing.T) {
+	cfg := NewSinkConfig([]string{"localhost:9092"}, "")
+	cfg.TopicExtractor = func(entry s.Entry) string {
+		if entry.Key == "unroutable" {
+			return ""
+		}
+		return "test_sink_batch_errors"
+	}
+	partial := NewKafkaSink(cfg, nil)
+
+	err := partial.Batch(
+		s.Entry{Key: "entry1", Value: []byte("value 1")},
+		s.Entry{Key: "unroutable", Value: []byte("value")},
+		s.Entry{Key: "too_large", Value: make([]byte, maxMessageBytes)},
+		s.Entry{Key: "entry2", Value: []byte("value 2")},
+	)
+
+	batchErr, ok := err.(*s.SinkBatchError)
+	assert.True(t, ok)
+	assert.Len(t, batchErr.Errors, 2)
+	assert.NotNil(t, batchErr.Errors["unroutable"])
+	assert.EqualValues(t, k.MessageSizeTooLarge, batchErr.Errors["too_large"])
+
+	messages := readTopic("test_sink_batch_errors", 2)
+	assert.EqualValues(t, "value 1", messages[0].Value)
+	assert.EqualValues(t, "value 2", messages[1].Value)
+}
@@ -5,180 +5,614 @@ import (
 	"fmt"
 	s "github.com/matang28/go-streams"
 	k "github.com/segmentio/kafka-go"
-	"io"
-	"net"
+	"regexp"
+	"sort"
 	"sync"
 	"time"
 )
 
 const kafkaSourceName = "kafkaSource"
 
+const (
+	defaultShutdownTimeout      = 10 * time.Second
+	defaultReconnectBackoffMin  = 500 * time.Millisecond
+	defaultReconnectBackoffMax  = 30 * time.Second
+	defaultTopicRefreshInterval = time.Minute
+	defaultBatchMaxLinger       = 100 * time.Millisecond
+)
+
 type kafkaSource struct {
-	name   string
-	cfg    SourceConfig
-	reader *k.Reader
-	conn   *k.Conn
+	name         string
+	cfg          SourceConfig
+	dialer       *k.Dialer
+	health       *HealthChecker
+	topicPattern *regexp.Regexp
+
+	offsets *OffsetTracker
+	commits *commitStats
+	fetches *fetchStats
+
+	// commitMutex serializes the commits, so an older watermark never reaches kafka after a newer one.
+	commitMutex sync.Mutex
+	dedup       *dedupWindow
+
+	// deadLetters writes to the DeadLetterTopic, nil if the source doesn't have one.
+	deadLetters *k.Writer
+
+	// retries holds a writer per RetryTiers, and delayed is set for the retry sources
+	// which hold every message back until its RetryNotBeforeHeader is due.
+	retries []*k.Writer
+	delayed bool
 
-	uncommittedMessages map[string]k.Message
-	closeCh             chan bool
-	mutex               sync.Mutex
+	session *sourceSession
+	mutex   sync.Mutex
+
+	// reconnects counts the reconnect attempts since the source last consumed and outageStart is when the
+	// first of them began, so the source keeps backing off while kafka is reachable but every session fails.
+	reconnects  int
+	outageStart time.Time
+
+	// positioned holds the partitions that were already started from the configured StartPosition,
+	// rewinds holds the offsets the partitions should be read from after a Rewind.
+	positioned map[TopicPartition]bool
+	rewinds    map[TopicPartition]int64
+
+	// pausedAll is set by Pause() and paused holds the partitions that were paused on their own,
+	// resumed is closed and replaced whenever partitions are resumed.
+	pausedAll bool
+	paused    map[TopicPartition]bool
+	resumed   chan struct{}
+
+	// ctx is cancelled by Stop, it aborts any in-flight fetch and any
+	// blocked delivery to the entry channel.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started bool
+	doneCh  chan struct{}
 }
 
 func NewKafkaSource(cfg SourceConfig) *kafkaSource {
+	if cfg.ValueExtractor == nil {
+		cfg.ValueExtractor = ValueEntryFunc
+	}
+
+	if cfg.OffsetStore != nil && cfg.ConsumerGroup != "" {
+		panic(fmt.Errorf("the kafka source can't use an OffsetStore together with a ConsumerGroup"))
+	}
+
+	dialer, err := newDialer(cfg.TLS, cfg.SASL)
+	if err != nil {
+		panic(err)
+	}
+
+	var topicPattern *regexp.Regexp
+	if cfg.TopicPattern != "" {
+		topicPattern = regexp.MustCompile(cfg.TopicPattern)
+	}
+
+	var dedup *dedupWindow
+	if cfg.DedupWindowSize > 0 {
+		dedup = newDedupWindow(cfg.DedupWindowSize)
+	}
+
+	var deadLetters *k.Writer
+	if cfg.DeadLetterTopic != "" {
+		deadLetters = newSourceWriter(cfg, dialer, cfg.DeadLetterTopic)
+	}
+
+	retries := make([]*k.Writer, len(cfg.RetryTiers))
+	for idx, tier := range cfg.RetryTiers {
+		if tier.Topic == "" || tier.DelayMs < 0 {
+			panic(fmt.Errorf("invalid kafka retry tier %+v", tier))
+		}
+		retries[idx] = newSourceWriter(cfg, dialer, tier.Topic)
+	}
+
 	name := fmt.Sprintf("%s-%d", kafkaSourceName, time.Now().UnixNano())
+	ctx, cancel := context.WithCancel(context.Background())
 	return &kafkaSource{
-		cfg:                 cfg,
-		name:                name,
-		uncommittedMessages: make(map[string]k.Message),
-		closeCh:             make(chan bool),
-		mutex:               sync.Mutex{},
+		cfg:          cfg,
+		name:         name,
+		dialer:       dialer,
+		health:       newHealthChecker(cfg.Hosts, dialer),
+		topicPattern: topicPattern,
+		offsets:      newOffsetTracker(cfg.DeadLetterTopic != "" || len(cfg.RetryTiers) > 0),
+		commits:      newCommitStats(),
+		fetches:      newFetchStats(),
+		dedup:        dedup,
+		deadLetters:  deadLetters,
+		retries:      retries,
+		mutex:        sync.Mutex{},
+		positioned:   make(map[TopicPartition]bool),
+		rewinds:      make(map[TopicPartition]int64),
+		paused:       make(map[TopicPartition]bool),
+		resumed:      make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+		doneCh:       make(chan struct{}),
 	}
 }
 
 func (this *kafkaSource) Start(channel s.EntryChannel, errorChannel s.ErrorChannel) {
-	s.Log().Info("Connecting to kafka with config: %+v", this.cfg)
-	if err := this.connect(); err != nil {
-		panic(err)
-	}
-	s.Log().Info("Connected to kafka with config: %+v", this.cfg)
+	this.mutex.Lock()
+	this.started = true
+	this.mutex.Unlock()
 
 	defer func() {
-		s.Log().Info("Disconnecting from kafka with config: %+v", this.cfg)
+		close(channel)
+		close(this.doneCh)
 		errorChannel <- s.NewEofError(this)
-		if err := this.disconnect(); err != nil {
-			panic(err)
-		}
-		s.Log().Info("Disconnected from kafka with config: %+v", this.cfg)
 	}()
 
-loop:
+	if this.cfg.StatsCallback != nil {
+		go this.reportStats()
+	}
+
+	for this.ctx.Err() == nil {
+		err := this.consume(channel, errorChannel)
+		switch {
+		case err == nil:
+		case err == errTopicsChanged:
+			s.Log().Info("Re-subscribing kafka source to the topics matching '%s'", this.cfg.TopicPattern)
+		case err == errRewound:
+			s.Log().Info("Kafka source was rewound, re-reading its partitions from the new offsets")
+		case !this.handleError(err, errorChannel):
+			return
+		}
+	}
+}
+
+// consume opens a new session and delivers its messages to the entry channel, it returns nil once the
+// source was stopped (keeping the session open so Stop can still commit), otherwise the session is
+// closed and the error that ended it is returned.
+func (this *kafkaSource) consume(channel s.EntryChannel, errorChannel s.ErrorChannel) error {
+	s.Log().Info("Connecting to kafka with config: %+v", this.cfg)
+	if err := this.Ping(); err != nil {
+		return err
+	}
+
+	topics, err := this.resolveTopics()
+	if err != nil {
+		return err
+	}
+
+	// Ping and resolveTopics may take a while, the session is only registered if the source wasn't stopped
+	// meanwhile, Stop cancels the context before it disconnects so it always sees the registered session.
+	session := newSourceSession(this, topics, errorChannel)
+	this.mutex.Lock()
+	if this.ctx.Err() != nil {
+		this.mutex.Unlock()
+		return nil
+	}
+	this.session = session
+	this.mutex.Unlock()
+	session.start()
+	s.Log().Info("Connected to kafka, consuming from topics: %v", topics)
+
+	// in batch mode the fetched messages are accumulated until the batch is full or until
+	// it lingered for too long, by default every message is delivered on its own.
+	var batch []k.Message
+	var batchBytes int
+	var linger <-chan time.Time
+	flush := func() bool {
+		owned := batch[:0]
+		for _, m := range batch {
+			// the partition may have been revoked since the message was fetched
+			if session.owns(TopicPartition{Topic: m.Topic, Partition: m.Partition}) {
+				owned = append(owned, m)
+			}
+		}
+		delivered := this.deliver(owned, channel, errorChannel)
+		if delivered && len(owned) > 0 {
+			this.resetReconnects()
+		}
+		batch, batchBytes, linger = nil, 0, nil
+		return delivered
+	}
+
 	for {
 		select {
-		case <-this.closeCh:
-			close(channel)
-			break loop
-		default:
-			m, err := this.reader.FetchMessage(context.Background())
-			if err != nil {
-				handleError(err, errorChannel)
-			} else {
-				entry := this.cfg.ValueExtractor(m)
-				if this.cfg.ConsumerGroup != "" {
-					this.mutex.Lock()
-					this.uncommittedMessages[entry.Key] = m
-					this.mutex.Unlock()
+		case <-this.ctx.Done():
+			return nil
+
+		case err := <-session.failures:
+			session.close()
+			return err
+
+		case <-linger:
+			if !flush() {
+				return nil
+			}
+
+		case m := <-session.fetched:
+			batch = append(batch, m)
+			batchBytes += len(m.Key) + len(m.Value)
+			if len(batch) >= this.cfg.BatchMaxMessages || (this.cfg.BatchMaxBytes > 0 && batchBytes >= this.cfg.BatchMaxBytes) {
+				if !flush() {
+					return nil
 				}
-				channel <- entry
+			} else if linger == nil {
+				linger = time.After(this.batchLinger())
 			}
 		}
 	}
 }
 
-func handleError(e error, channel s.ErrorChannel) {
-	if e != nil {
-		if e == io.EOF {
-			panic(e)
+// deliver extracts and tracks a batch of messages at once and sends its entries to the entry channel,
+// it returns false if the source was stopped before all the entries were delivered.
+func (this *kafkaSource) deliver(messages []k.Message, channel s.EntryChannel, errorChannel s.ErrorChannel) bool {
+	entries := make([]s.Entry, len(messages))
+	keys := make([]string, len(messages))
+	failures := make([]error, len(messages))
+	for idx := range messages {
+		entries[idx], failures[idx] = this.extract(messages[idx])
+		keys[idx] = entries[idx].Key
+	}
+
+	if this.commitsOffsets() {
+		this.offsets.TrackBatch(keys, messages)
+	}
+
+	// the remaining entries were never handed to the stream, forget about them
+	// so they will be redelivered to the next consumer of their partitions.
+	forget := func(from int) {
+		for last := len(entries) - 1; last >= from; last-- {
+			this.offsets.Forget(entries[last].Key)
 		}
+	}
 
-		_, ok := e.(*net.OpError)
-		if ok {
-			panic(e)
+	for idx := range entries {
+		// failures and duplicates are acknowledged in order, so the entries after them are
+		// still pending if the source is stopped and can be forgotten
+		if failures[idx] != nil {
+			if !this.deadLetter(failures[idx], messages[idx], errorChannel) {
+				forget(idx)
+				return false
+			}
+			this.offsets.Ack(keys[idx])
+			continue
 		}
 
-		channel <- e
+		if this.dedup != nil && this.dedup.isDuplicate(messages[idx]) {
+			this.offsets.Ack(keys[idx])
+			continue
+		}
+
+		select {
+		case channel <- entries[idx]:
+		case <-this.ctx.Done():
+			forget(idx)
+			return false
+		}
 	}
+	return true
 }
 
-func (this *kafkaSource) Stop() error {
-	this.closeCh <- true
-	return nil
+func (this *kafkaSource) batchLinger() time.Duration {
+	if this.cfg.BatchMaxLingerMs <= 0 {
+		return defaultBatchMaxLinger
+	}
+	return time.Duration(this.cfg.BatchMaxLingerMs) * time.Millisecond
 }
 
-func (this *kafkaSource) CommitEntry(keys ...string) error {
-	if this.cfg.ConsumerGroup == "" {
-		return nil
+// resolveTopics returns the sorted list of topics this source should consume from.
+func (this *kafkaSource) resolveTopics() ([]string, error) {
+	unique := make(map[string]bool)
+	if this.cfg.Topic != "" {
+		unique[this.cfg.Topic] = true
+	}
+	for _, topic := range this.cfg.Topics {
+		unique[topic] = true
 	}
 
-	messages := make([]k.Message, len(keys))
-	for _, key := range keys {
-		m, found := this.uncommittedMessages[key]
-		if found {
-			messages = append(messages, m)
+	if this.topicPattern != nil {
+		conn, err := dialAny(this.dialer, this.cfg.Hosts)
+		if err != nil {
+			return nil, err
 		}
-		this.mutex.Lock()
-		delete(this.uncommittedMessages, key)
-		this.mutex.Unlock()
+		partitions, err := conn.ReadPartitions()
+		conn.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, partition := range partitions {
+			if this.topicPattern.MatchString(partition.Topic) {
+				unique[partition.Topic] = true
+			}
+		}
+	}
+
+	topics := make([]string, 0, len(unique))
+	for topic := range unique {
+		topics = append(topics, topic)
 	}
-	return this.reader.CommitMessages(context.Background(), messages...)
+	sort.Strings(topics)
+	return topics, nil
 }
 
-func (this *kafkaSource) Name() string {
-	return this.name
+func dialAny(dialer *k.Dialer, hosts []string) (*k.Conn, error) {
+	err := fmt.Errorf("no kafka hosts were configured")
+	for _, host := range hosts {
+		var conn *k.Conn
+		if conn, err = dialer.Dial("tcp", host); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
 }
 
-func (this *kafkaSource) Ping() error {
+// dialLeader connects to the leader of the partition through the first host that can reach it,
+// giving up on a host after the dialer's timeout.
+func dialLeader(ctx context.Context, dialer *k.Dialer, hosts []string, tp TopicPartition) (*k.Conn, error) {
+	err := fmt.Errorf("no kafka hosts were configured")
+	for _, host := range hosts {
+		dialCtx, cancel := context.WithTimeout(ctx, dialer.Timeout)
+		var conn *k.Conn
+		conn, err = dialer.DialLeader(dialCtx, "tcp", host, tp.Topic, tp.Partition)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// handleError reports the given error and recovers from it when possible,
+// it returns false if the source can't keep on consuming.
+func (this *kafkaSource) handleError(err error, errorChannel s.ErrorChannel) bool {
+	sourceErr := NewSourceError(err)
+	reportError(this.ctx, errorChannel, sourceErr)
+
+	switch sourceErr.Kind {
+	case FatalError:
+		s.Log().Error("Kafka source failed with a fatal error, stopping: %s", err.Error())
+		return false
+	case RebalanceError:
+		return true
+	default:
+		return this.reconnect(err, errorChannel)
+	}
+}
+
+// reconnect waits for kafka to be reachable again with an exponential backoff, it returns
+// false if the source was stopped or if a fatal error occurred while reconnecting.
+func (this *kafkaSource) reconnect(cause error, errorChannel s.ErrorChannel) bool {
+	for {
+		attempt, outageStart := this.nextReconnect()
+		backoff := reconnectBackoff(attempt,
+			time.Duration(this.cfg.ReconnectBackoffMinMs)*time.Millisecond,
+			time.Duration(this.cfg.ReconnectBackoffMaxMs)*time.Millisecond)
+		reportError(this.ctx, errorChannel, &OutageError{Err: cause, Attempt: attempt, Backoff: backoff})
+		s.Log().Warn("Kafka source lost its connection, reconnecting in %s (attempt %d): %s", backoff, attempt, cause.Error())
+
+		select {
+		case <-time.After(backoff):
+		case <-this.ctx.Done():
+			return false
+		}
+
+		this.disconnect()
+
+		if cause = this.Ping(); cause == nil {
+			// the next session resumes from the committed offsets, everything that
+			// was tracked since will be fetched again.
+			this.offsets.Reset()
+			reportError(this.ctx, errorChannel, &RecoveredError{Attempts: attempt, Downtime: time.Since(outageStart)})
+			s.Log().Info("Kafka source reconnected after %d attempts", attempt)
+			return true
+		}
+
+		if ClassifyError(cause) == FatalError {
+			reportError(this.ctx, errorChannel, NewSourceError(cause))
+			return false
+		}
+	}
+}
+
+// nextReconnect counts a reconnect attempt and returns it together with the start of the outage, the attempts
+// only start over once a session was assigned its partitions or delivered an entry (see resetReconnects).
+func (this *kafkaSource) nextReconnect() (int, time.Time) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.reconnects == 0 {
+		this.outageStart = time.Now()
+	}
+	this.reconnects++
+	return this.reconnects, this.outageStart
+}
+
+// resetReconnects ends the current outage, it's called once a session has actually consumed.
+func (this *kafkaSource) resetReconnects() {
+	this.mutex.Lock()
+	this.reconnects = 0
+	this.mutex.Unlock()
+}
+
+func reconnectBackoff(attempt int, min time.Duration, max time.Duration) time.Duration {
+	if min <= 0 {
+		min = defaultReconnectBackoffMin
+	}
+	if max < min {
+		max = defaultReconnectBackoffMax
+	}
+
+	backoff := min
+	for i := 1; i < attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// Stop cancels any in-flight fetch, waits (up to the configured shutdown timeout)
+// for the entries that were already handed to the stream to be committed and
+// then closes the underlying readers, entries that weren't committed by then will
+// be redelivered by kafka.
+func (this *kafkaSource) Stop() error {
+	s.Log().Info("Stopping kafka source with config: %+v", this.cfg)
+	this.cancel()
+
+	this.mutex.Lock()
+	started := this.started
+	this.mutex.Unlock()
+	if !started {
+		this.closeWriters()
+		return nil
+	}
+
+	timeout := time.Duration(this.cfg.ShutdownTimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	deadline := time.After(timeout)
+
 	var err error
+	select {
+	case <-this.doneCh:
+		if session := this.currentSession(); session != nil {
+			session.revokeAssigned()
+		}
+		if pending := this.awaitCommits(deadline); pending > 0 {
+			err = fmt.Errorf("kafka source was stopped with %d uncommitted entries, they will be redelivered", pending)
+		}
+		if commitErr := this.commitAcknowledged(); commitErr != nil && err == nil {
+			err = commitErr
+		}
+	case <-deadline:
+		err = fmt.Errorf("timeout after %s while waiting for kafka source to stop", timeout)
+	}
 
-	if this.conn == nil {
-		for _, host := range this.cfg.Hosts {
-			this.conn, err = k.Dial("tcp", host)
-			if err != nil {
-				continue
-			}
+	s.Log().Info("Disconnecting from kafka with config: %+v", this.cfg)
+	this.disconnect()
+	this.closeWriters()
+	s.Log().Info("Disconnected from kafka with config: %+v", this.cfg)
+	return err
+}
+
+// awaitCommits blocks until all the delivered entries were acknowledged or until the deadline
+// has passed, it returns the number of entries that are still outstanding.
+func (this *kafkaSource) awaitCommits(deadline <-chan time.Time) int {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		pending := this.offsets.Outstanding()
+		if pending == 0 {
+			return 0
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return pending
 		}
 	}
-	if err != nil {
-		return err
+}
+
+// CommitEntry acknowledges the given entries, each partition is committed up to its
+// highest contiguous acknowledged offset so an entry is never committed before
+// all the earlier entries of its partition.
+// When the source is configured with a CommitInterval the offsets are committed periodically, a source
+// that isn't part of a consumer group only commits when it has an OffsetStore, otherwise it doesn't even
+// track the entries it delivers and CommitEntry does nothing.
+func (this *kafkaSource) CommitEntry(keys ...string) error {
+	this.offsets.Ack(keys...)
+	if this.cfg.CommitIntervalMs > 0 {
+		return nil
+	}
+	return this.commitAcknowledged()
+}
+
+// Progress returns the pending/acknowledged entries count and the watermarks of every partition
+// this source has consumed from.
+func (this *kafkaSource) Progress() map[TopicPartition]PartitionProgress {
+	return this.offsets.Progress()
+}
+
+// commitsOffsets returns true if the source commits its entries, to the consumer group or to its OffsetStore.
+func (this *kafkaSource) commitsOffsets() bool {
+	return this.cfg.ConsumerGroup != "" || this.cfg.OffsetStore != nil
+}
+
+func (this *kafkaSource) commitAcknowledged() error {
+	session := this.currentSession()
+	if !this.commitsOffsets() || session == nil {
+		return nil
+	}
+
+	this.commitMutex.Lock()
+	defer this.commitMutex.Unlock()
+
+	commits := this.offsets.Committable()
+	if len(commits) == 0 {
+		return nil
 	}
 
-	brokers, err := this.conn.Brokers()
+	start := time.Now()
+	committed, err := session.commit(commits)
 	if err != nil {
 		return err
 	}
-
-	if len(brokers) <= 0 {
-		return fmt.Errorf("failed to get a valid list of kafka brokers")
+	if len(committed) > 0 {
+		this.commits.observe(time.Since(start))
 	}
+	this.offsets.MarkCommitted(committed)
+	return nil
+}
 
+func (this *kafkaSource) Name() string {
+	return this.name
+}
+
+// Ping succeeds when at least one of the kafka hosts is reachable, see HealthChecker.Check.
+func (this *kafkaSource) Ping() error {
+	report := this.Health()
+	if err := report.Err(); err != nil {
+		return err
+	}
+	if len(report.MissingTopics) > 0 {
+		s.Log().Warn("Kafka source topics %v don't exist yet", report.MissingTopics)
+	}
 	return nil
 }
 
-func (this *kafkaSource) connect() error {
-	this.reader = k.NewReader(k.ReaderConfig{
-		Brokers:                this.cfg.Hosts,
-		Topic:                  this.cfg.Topic,
-		GroupID:                this.cfg.ConsumerGroup,
-		QueueCapacity:          this.cfg.QueueCapacity,
-		MaxWait:                time.Duration(this.cfg.MaxWaitSeconds) * time.Second,
-		ReadLagInterval:        time.Duration(this.cfg.ReadLagIntervalSec) * time.Second,
-		HeartbeatInterval:      time.Duration(this.cfg.HeartbeatIntervalSec) * time.Second,
-		CommitInterval:         time.Duration(this.cfg.CommitIntervalMs) * time.Millisecond,
-		PartitionWatchInterval: time.Duration(this.cfg.PartitionWatchIntervalSec) * time.Second,
-		WatchPartitionChanges:  this.cfg.WatchPartitionChanges,
-		SessionTimeout:         time.Duration(this.cfg.SessionTimeoutSec) * time.Second,
-		RebalanceTimeout:       time.Duration(this.cfg.RebalanceTimeoutSec) * time.Second,
-		JoinGroupBackoff:       time.Duration(this.cfg.JoinGroupBackoffSec) * time.Second,
-		StartOffset:            this.cfg.StartOffset,
-		ReadBackoffMin:         time.Duration(this.cfg.ReadBackoffMinMs) * time.Millisecond,
-		ReadBackoffMax:         time.Duration(this.cfg.ReadBackoffMaxMs) * time.Millisecond,
-		MaxAttempts:            this.cfg.MaxAttempts,
-	})
-
-	err := this.Ping()
-	return err
+// Health probes all the configured hosts and checks that the configured topics exist,
+// the topics matching the TopicPattern aren't checked.
+func (this *kafkaSource) Health() HealthReport {
+	var topics []string
+	if this.cfg.Topic != "" {
+		topics = append(topics, this.cfg.Topic)
+	}
+	topics = append(topics, this.cfg.Topics...)
+	return this.health.Check(topics...)
 }
 
-func (this *kafkaSource) disconnect() error {
-	if this.reader != nil {
-		if err := this.reader.Close(); err != nil {
-			return err
-		}
+func (this *kafkaSource) currentSession() *sourceSession {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.session
+}
+
+func (this *kafkaSource) disconnect() {
+	if session := this.currentSession(); session != nil {
+		session.close()
 	}
+}
 
-	if this.conn != nil {
-		if err := this.conn.Close(); err != nil {
-			return err
+// closeWriters releases the writers of the dead letter and retry topics, a closed writer can't
+// be used anymore so it's only called once the source was stopped and not on every reconnect.
+func (this *kafkaSource) closeWriters() {
+	writers := append([]*k.Writer(nil), this.retries...)
+	if this.deadLetters != nil {
+		writers = append(writers, this.deadLetters)
+	}
+	for _, writer := range writers {
+		if err := writer.Close(); err != nil {
+			s.Log().Warn("Failed to close a kafka source writer: %s", err.Error())
 		}
 	}
-	return nil
 }
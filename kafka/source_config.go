@@ -10,10 +10,42 @@ type SourceConfig struct {
 	Hosts []string
 	Topic string
 
+	// TLS optionally enables TLS connections to the brokers.
+	TLS *TLSConfig
+
+	// SASL optionally enables SASL authentication (PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512).
+	SASL *SASLConfig
+
+	// Topics holds additional topics to consume from, the source subscribes to
+	// all of them (together with Topic) using a single consumer group.
+	Topics []string
+
+	// TopicPattern is an optional regular expression, the source also subscribes
+	// to every topic that matches it.
+	TopicPattern string
+
+	// TopicRefreshInterval sets how often the topics matching TopicPattern are
+	// re-evaluated in order to pick up new topics.
+	//
+	// Default: 60s
+	TopicRefreshIntervalSec int
+
 	// GroupID holds the optional consumer group id.  If GroupID is specified, then
 	// Partition should NOT be specified e.g. 0
 	ConsumerGroup string
 
+	// Partitions optionally sets the partitions the source reads from every topic when it isn't part of
+	// a consumer group, set AllPartitions to read all the partitions of the topics instead.
+	//
+	// Default: only partition 0
+	Partitions    []int
+	AllPartitions bool
+
+	// OffsetStore optionally checkpoints the offsets of a source that isn't part of a consumer group, so the
+	// acknowledged entries are committed to it and the partitions resume from the stored offsets (partitions
+	// without one start from StartOffset). Use NewMemoryOffsetStore, NewFileOffsetStore or NewDocumentOffsetStore.
+	OffsetStore OffsetStore
+
 	// The capacity of the internal message queue, defaults to 100 if none is
 	// set.
 	QueueCapacity int
@@ -35,11 +67,11 @@ type SourceConfig struct {
 	HeartbeatIntervalSec int
 
 	// CommitInterval indicates the interval at which offsets are committed to
-	// the broker.  If 0, commits will be handled synchronously.
+	// the broker, or saved to the OffsetStore.  If 0, commits will be handled synchronously.
 	//
 	// Default: 1 second
 	//
-	// Only used when GroupID is set
+	// Only used when GroupID or OffsetStore is set
 	CommitIntervalMs int
 
 	// PartitionWatchInterval indicates how often a reader checks for partition changes.
@@ -87,6 +119,42 @@ type SourceConfig struct {
 	// Only used when GroupID is set
 	StartOffset int64
 
+	// StartPosition optionally overrides the committed offsets, e.g. to replay a topic from a given
+	// timestamp, it's applied once per partition, the first time the partition is assigned to the source.
+	StartPosition StartPosition
+
+	// OnPartitionsAssigned is optionally called with the partitions that were assigned to the source,
+	// before any of them is read.
+	OnPartitionsAssigned func(partitions []TopicPartition)
+
+	// OnPartitionsRevoked is optionally called with the partitions that are about to be revoked from the
+	// source (on a rebalance, a reconnect or when the source is stopped). It's called before the final
+	// commit of those partitions, so the caller can flush its in-memory state and call CommitEntry for
+	// everything it has processed before the partitions move to another instance. When the source is
+	// stopped it's called once, before Stop waits for the outstanding entries.
+	OnPartitionsRevoked func(partitions []TopicPartition)
+
+	// DeadLetterTopic optionally enables the dead letter topic: messages the ValueExtractor panics on, and
+	// entries that are nacked with NackEntry, are written to it (with their origin and the error in the
+	// DeadLetter* headers) and are then committed, so a poison message never blocks its partition.
+	// Nacking entries requires a ConsumerGroup or an OffsetStore, the other sources don't track their entries.
+	DeadLetterTopic string
+
+	// RetryTiers optionally enables retry topics: entries that are retried with RetryEntry are written to the
+	// tier matching their number of attempts, with a RetryNotBeforeHeader of now + the tier's delay, and are
+	// then committed. The retried entries are emitted again by the source created with NewKafkaRetrySource
+	// once they are due, entries that were retried more times than there are tiers go to the DeadLetterTopic.
+	// Like nacking, retrying entries requires a ConsumerGroup or an OffsetStore.
+	RetryTiers []RetryTier
+
+	// DedupWindowSize enables the deduplication of messages produced by a sink in the idempotent mode,
+	// a message whose DedupHeader was already seen at another position among the last DedupWindowSize
+	// messages is committed without being delivered. The window is kept in memory, so it covers the
+	// duplicates that a producer's retries write close to each other.
+	//
+	// Default: 0 (disabled)
+	DedupWindowSize int
+
 	// BackoffDelayMin optionally sets the smallest amount of time the reader will wait before
 	// polling for new messages
 	//
@@ -104,7 +172,53 @@ type SourceConfig struct {
 	// The default is to try 5 times.
 	MaxAttempts int
 
-	// Enables the caller to choose what the output entry will be after the message was received.
+	// BatchMaxMessages enables the batch mode when greater than 1, the fetched messages
+	// are accumulated and delivered together once the batch holds that many messages,
+	// once it holds BatchMaxBytes or once it waited for BatchMaxLinger.
+	//
+	// Default: 1 (every message is delivered on its own)
+	BatchMaxMessages int
+
+	// BatchMaxBytes limits the total size (keys and values) of a batch, 0 means no limit.
+	//
+	// Only used when BatchMaxMessages is greater than 1
+	BatchMaxBytes int
+
+	// BatchMaxLinger limits how long a batch may wait to be filled before it's delivered.
+	//
+	// Default: 100ms
+	//
+	// Only used when BatchMaxMessages is greater than 1
+	BatchMaxLingerMs int
+
+	// ReconnectBackoffMin sets the delay before the first attempt to re-create the
+	// reader after a transient failure, the delay doubles on every failed attempt.
+	//
+	// Default: 500ms
+	ReconnectBackoffMinMs int
+
+	// ReconnectBackoffMax caps the delay between reconnect attempts.
+	//
+	// Default: 30s
+	ReconnectBackoffMaxMs int
+
+	// ShutdownTimeout limits how long Stop will wait for the entries that were already
+	// sent to the stream to be committed before closing the reader.
+	//
+	// Default: 10s
+	ShutdownTimeoutSec int
+
+	// StatsCallback is optionally called every StatsInterval with the source's metrics (lag, fetch rate,
+	// commit latency, etc...) of the period since its previous call.
+	StatsCallback func(stats SourceStats)
+
+	// StatsInterval sets how often StatsCallback is called.
+	//
+	// Default: 60s
+	StatsIntervalSec int
+
+	// Enables the caller to choose what the output entry will be after the message was received,
+	// the message's Topic and Partition are always set so the extractor can tell where it came from.
 	//
 	// The default is ValueEntryFunc to preserve backward computability
 	ValueExtractor ValueExtractorFunc
@@ -115,6 +229,7 @@ func NewSourceConfig(hosts []string, topic string, consumerGroupId string) Sourc
 	out.Hosts = hosts
 	out.Topic = topic
 	out.ConsumerGroup = consumerGroupId
+	out.TopicRefreshIntervalSec = 60
 	out.QueueCapacity = 100
 	out.MaxWaitSeconds = 10
 	out.ReadLagIntervalSec = 60
@@ -129,6 +244,13 @@ func NewSourceConfig(hosts []string, topic string, consumerGroupId string) Sourc
 	out.ReadBackoffMinMs = 100
 	out.ReadBackoffMaxMs = 1000
 	out.MaxAttempts = 5
+	out.BatchMaxMessages = 1
+	out.BatchMaxBytes = 0
+	out.BatchMaxLingerMs = 100
+	out.ReconnectBackoffMinMs = 500
+	out.ReconnectBackoffMaxMs = 30000
+	out.ShutdownTimeoutSec = 10
+	out.StatsIntervalSec = 60
 	out.ValueExtractor = ValueEntryFunc
 	return out
 }
@@ -140,7 +262,7 @@ var (
 	// default
 	ValueEntryFunc = func(m k.Message) s.Entry {
 		return s.Entry{
-			Key:   fmt.Sprintf("%d-%s", m.Offset, m.Key),
+			Key:   MessageKey(m),
 			Value: m.Value,
 		}
 	}
@@ -148,8 +270,23 @@ var (
 	// can provide all the message parameters when needed
 	MessageEntryFunc = func(m k.Message) s.Entry {
 		return s.Entry{
-			Key:   fmt.Sprintf("%d-%s", m.Offset, m.Key),
+			Key:   MessageKey(m),
 			Value: m,
 		}
 	}
+
+	// provides the message as a connector neutral Record, including its headers and timestamp
+	RecordEntryFunc = func(m k.Message) s.Entry {
+		return s.Entry{
+			Key:   MessageKey(m),
+			Value: NewRecord(m),
+		}
+	}
 )
+
+// MessageKey generates the default entry key of a message: its offset and its key. The key isn't unique across
+// partitions, the source resolves the messages of the same entry key in the order they were fetched, so entries
+// sharing a key should be committed in that order (or given unique keys by a custom ValueExtractorFunc).
+func MessageKey(m k.Message) string {
+	return fmt.Sprintf("%d-%s", m.Offset, m.Key)
+}
@@ -0,0 +1,140 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"strconv"
+	"time"
+)
+
+// The headers a message carries in the dead letter topic, on top of its original headers.
+const (
+	DeadLetterTopicHeader     = "x-dead-letter-topic"
+	DeadLetterPartitionHeader = "x-dead-letter-partition"
+	DeadLetterOffsetHeader    = "x-dead-letter-offset"
+	DeadLetterErrorHeader     = "x-dead-letter-error"
+)
+
+// ErrNacked is the error recorded for the entries that were nacked by NackEntry.
+var ErrNacked = fmt.Errorf("the entry was nacked")
+
+// newSourceWriter creates the writer a source uses to forward the messages it failed on to another topic.
+func newSourceWriter(cfg SourceConfig, dialer *k.Dialer, topic string) *k.Writer {
+	return k.NewWriter(k.WriterConfig{
+		Brokers:      cfg.Hosts,
+		Topic:        topic,
+		Dialer:       dialer,
+		Balancer:     k.Murmur2Balancer{},
+		BatchTimeout: 10 * time.Millisecond,
+		RequiredAcks: -1,
+	})
+}
+
+// NackEntry sends the given entries to the dead letter topic and commits them, so a poison message
+// doesn't hold back its partition, it fails if the source wasn't configured with a DeadLetterTopic.
+// Unknown keys, or keys that were already acknowledged, are ignored.
+func (this *kafkaSource) NackEntry(keys ...string) error {
+	return this.NackEntryWithError(ErrNacked, keys...)
+}
+
+// NackEntryWithError is like NackEntry, the given error is recorded in the DeadLetterErrorHeader.
+func (this *kafkaSource) NackEntryWithError(cause error, keys ...string) error {
+	if this.deadLetters == nil {
+		return fmt.Errorf("the kafka source can't nack entries without a DeadLetterTopic")
+	}
+	if !this.commitsOffsets() {
+		return fmt.Errorf("the kafka source can't nack entries without a ConsumerGroup or an OffsetStore")
+	}
+
+	var nacked []string
+	var messages []k.Message
+	for _, key := range keys {
+		if m, found := this.offsets.Message(key); found {
+			nacked = append(nacked, key)
+			messages = append(messages, m)
+		}
+	}
+
+	if err := this.writeDeadLetters(cause, messages...); err != nil {
+		return err
+	}
+	return this.CommitEntry(nacked...)
+}
+
+// deadLetter sends a message the source failed on to the dead letter topic, retrying until it succeeds
+// since the message can't be committed before that, it returns false if the source was stopped.
+func (this *kafkaSource) deadLetter(cause error, m k.Message, errorChannel s.ErrorChannel) bool {
+	s.Log().Warn("Sending kafka message %s[%d]@%d to the dead letter topic: %s", m.Topic, m.Partition, m.Offset, cause.Error())
+	for attempt := 1; ; attempt++ {
+		err := this.writeDeadLetters(cause, m)
+		if err == nil {
+			return true
+		}
+		reportError(this.ctx, errorChannel, NewSourceError(err))
+
+		backoff := reconnectBackoff(attempt,
+			time.Duration(this.cfg.ReconnectBackoffMinMs)*time.Millisecond,
+			time.Duration(this.cfg.ReconnectBackoffMaxMs)*time.Millisecond)
+		select {
+		case <-time.After(backoff):
+		case <-this.ctx.Done():
+			return false
+		}
+	}
+}
+
+func (this *kafkaSource) writeDeadLetters(cause error, messages ...k.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	letters := make([]k.Message, len(messages))
+	for idx, m := range messages {
+		letters[idx] = forwarded(m,
+			k.Header{Key: DeadLetterTopicHeader, Value: []byte(m.Topic)},
+			k.Header{Key: DeadLetterPartitionHeader, Value: []byte(strconv.Itoa(m.Partition))},
+			k.Header{Key: DeadLetterOffsetHeader, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+			k.Header{Key: DeadLetterErrorHeader, Value: []byte(cause.Error())},
+		)
+	}
+
+	if err := this.deadLetters.WriteMessages(context.Background(), letters...); err != nil {
+		return fmt.Errorf("failed to write %d messages to the dead letter topic '%s': %s",
+			len(letters), this.cfg.DeadLetterTopic, err.Error())
+	}
+	return nil
+}
+
+// extract runs the ValueExtractor on the message, when the source has a dead letter topic a panic
+// of the extractor is recovered and returned, so the message can be sent to the dead letter topic.
+func (this *kafkaSource) extract(m k.Message) (entry s.Entry, err error) {
+	if this.deadLetters != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				entry = s.Entry{Key: MessageKey(m)}
+				err = fmt.Errorf("the kafka source value extractor failed: %v", r)
+			}
+		}()
+	}
+	return this.cfg.ValueExtractor(m), nil
+}
+
+// forwarded copies a message so it can be written to another topic, the given headers replace
+// any header of the message with the same key.
+func forwarded(m k.Message, headers ...k.Header) k.Message {
+	replaced := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		replaced[header.Key] = true
+	}
+
+	var out []k.Header
+	for _, header := range m.Headers {
+		if !replaced[header.Key] {
+			out = append(out, header)
+		}
+	}
+	out = append(out, headers...)
+	return k.Message{Key: m.Key, Value: m.Value, Headers: out, Time: m.Time}
+}
@@ -0,0 +1,79 @@
+package kafka
+
+import (
+	"fmt"
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestKafkaSource_DeadLetter(t *testing.T) {
+	producer := NewKafkaSink(NewSinkConfig([]string{"localhost:9092"}, "test_source_dead_letter"), nil)
+	panicOnErr(producer.Batch(
+		s.Entry{Key: "entry0", Value: []byte("poison")},
+		s.Entry{Key: "entry1", Value: []byte("nacked")},
+		s.Entry{Key: "entry2", Value: []byte("processed")},
+	))
+
+	cfg := NewSourceConfig([]string{"localhost:9092"}, "test_source_dead_letter", "test_source_dead_letter_cg")
+	cfg.StartOffset = k.FirstOffset
+	cfg.CommitIntervalMs = 0
+	cfg.DeadLetterTopic = "test_source_dead_letter_dlq"
+	cfg.ValueExtractor = func(m k.Message) s.Entry {
+		if string(m.Value) == "poison" {
+			panic("can't extract a poison message")
+		}
+		return s.Entry{Key: MessageKey(m), Value: m.Value}
+	}
+	source, entries := startSource(t, cfg)
+	defer source.Stop()
+
+	// the poison message is never handed to the stream
+	nacked := nextEntry(t, entries)
+	assert.EqualValues(t, "nacked", nacked.Value)
+	assert.Nil(t, source.NackEntry(nacked.Key))
+
+	processed := nextEntry(t, entries)
+	assert.EqualValues(t, "processed", processed.Value)
+	assert.Nil(t, source.CommitEntry(processed.Key))
+
+	letters := readTopic(cfg.DeadLetterTopic, 2)
+	for idx, expected := range []string{"poison", "nacked"} {
+		record := NewRecord(letters[idx])
+		assert.EqualValues(t, expected, record.Value)
+		assert.EqualValues(t, "test_source_dead_letter", record.Header(DeadLetterTopicHeader))
+		assert.EqualValues(t, "0", record.Header(DeadLetterPartitionHeader))
+		assert.EqualValues(t, strconv.Itoa(idx), record.Header(DeadLetterOffsetHeader))
+	}
+	assert.Contains(t, string(NewRecord(letters[0]).Header(DeadLetterErrorHeader)), "can't extract a poison message")
+	assert.EqualValues(t, ErrNacked.Error(), NewRecord(letters[1]).Header(DeadLetterErrorHeader))
+
+	tp := TopicPartition{Topic: "test_source_dead_letter", Partition: 0}
+	assert.EqualValues(t, 3, source.Progress()[tp].Committed)
+}
+
+func TestKafkaSource_NackEntry_WithoutDeadLetterTopic(t *testing.T) {
+	source := NewKafkaSource(NewSourceConfig([]string{"localhost:9092"}, "test_source_nack", "test_source_nack_cg"))
+	assert.NotNil(t, source.NackEntry("entry0"))
+}
+
+func TestKafkaSource_NackEntry_AfterReconnect(t *testing.T) {
+	cfg := NewSourceConfig([]string{"localhost:9092"}, "test_source_nack_reconnect", "test_source_nack_reconnect_cg")
+	cfg.DeadLetterTopic = "test_source_nack_reconnect_dlq"
+	cfg.ReconnectBackoffMinMs = 10
+	source := NewKafkaSource(cfg)
+	defer source.Stop()
+
+	// a reconnect only replaces the session, the dead letter writer must remain usable
+	assert.True(t, source.reconnect(fmt.Errorf("outage"), make(s.ErrorChannel, 100)))
+
+	m := k.Message{Topic: "test_source_nack_reconnect", Partition: 0, Offset: 0, Value: []byte("nacked")}
+	source.offsets.Track(MessageKey(m), m)
+	assert.Nil(t, source.NackEntry(MessageKey(m)))
+
+	letters := readWithin(t, cfg.DeadLetterTopic, 1, 30*time.Second)
+	assert.EqualValues(t, "nacked", NewRecord(letters[0]).Value)
+}
@@ -0,0 +1,76 @@
+package kafka
+
+import (
+	"context"
+	s "github.com/matang28/go-streams"
+)
+
+// Pause stops fetching from the given partitions, or from every partition if none is given, e.g. to apply
+// backpressure when the downstream stages are slow.
+// The source stays a member of its consumer group while paused (the group heartbeats aren't affected),
+// the messages that were already fetched are still delivered and pausing survives reconnects and rebalances.
+func (this *kafkaSource) Pause(partitions ...TopicPartition) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if len(partitions) == 0 {
+		this.pausedAll = true
+		s.Log().Info("Kafka source was paused")
+		return
+	}
+
+	for _, tp := range partitions {
+		this.paused[tp] = true
+	}
+	s.Log().Info("Kafka source paused partitions %v", partitions)
+}
+
+// Resume continues fetching from the given partitions, or from every partition if none is given.
+// Notice that a partition that was paused by Pause() without any partition is only resumed by Resume() without any partition.
+func (this *kafkaSource) Resume(partitions ...TopicPartition) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if len(partitions) == 0 {
+		this.pausedAll = false
+		this.paused = make(map[TopicPartition]bool)
+		s.Log().Info("Kafka source was resumed")
+	} else {
+		for _, tp := range partitions {
+			delete(this.paused, tp)
+		}
+		s.Log().Info("Kafka source resumed partitions %v", partitions)
+	}
+
+	// wake up every reader that waits for its partition to be resumed
+	close(this.resumed)
+	this.resumed = make(chan struct{})
+}
+
+// IsPaused returns true if the given partition is currently paused.
+func (this *kafkaSource) IsPaused(tp TopicPartition) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.pausedAll || this.paused[tp]
+}
+
+// awaitResumed blocks while the given partition is paused, it returns false if the context was done before
+// the partition was resumed.
+func (this *kafkaSource) awaitResumed(ctx context.Context, tp TopicPartition) bool {
+	for {
+		this.mutex.Lock()
+		paused := this.pausedAll || this.paused[tp]
+		resumed := this.resumed
+		this.mutex.Unlock()
+
+		if !paused {
+			return true
+		}
+
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPause_AwaitResumed(t *testing.T) {
+	paused := NewKafkaSource(NewSourceConfig([]string{"localhost:9092"}, "topic", "cg"))
+	tp0 := TopicPartition{Topic: "topic", Partition: 0}
+	tp1 := TopicPartition{Topic: "topic", Partition: 1}
+
+	paused.Pause(tp0)
+	assert.True(t, paused.IsPaused(tp0))
+	assert.False(t, paused.IsPaused(tp1))
+	assert.True(t, paused.awaitResumed(context.Background(), tp1))
+
+	resumed := make(chan bool)
+	go func() {
+		resumed <- paused.awaitResumed(context.Background(), tp0)
+	}()
+
+	select {
+	case <-resumed:
+		t.Fatal("a paused partition must not be resumed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	paused.Resume(tp0)
+	assert.True(t, <-resumed)
+	assert.False(t, paused.IsPaused(tp0))
+}
+
+func TestPause_All(t *testing.T) {
+	paused := NewKafkaSource(NewSourceConfig([]string{"localhost:9092"}, "topic", "cg"))
+	tp := TopicPartition{Topic: "topic", Partition: 0}
+
+	paused.Pause()
+	assert.True(t, paused.IsPaused(tp))
+
+	// a partition that was paused globally isn't resumed on its own
+	paused.Resume(tp)
+	assert.True(t, paused.IsPaused(tp))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.False(t, paused.awaitResumed(ctx, tp))
+
+	paused.Resume()
+	assert.False(t, paused.IsPaused(tp))
+}
+
+func TestKafkaSource_PauseResume(t *testing.T) {
+	cfg := NewSourceConfig([]string{"localhost:9092"}, "test_source_pause", "test_source_pause_cg")
+	cfg.StartOffset = k.FirstOffset
+	paused := NewKafkaSource(cfg)
+	paused.Pause()
+
+	entries := make(s.EntryChannel, 10)
+	go paused.Start(entries, make(s.ErrorChannel, 100))
+	defer paused.Stop()
+
+	producer := NewKafkaSink(NewSinkConfig([]string{"localhost:9092"}, "test_source_pause"), nil)
+	for i := 0; i < 3; i++ {
+		panicOnErr(producer.Single(s.Entry{Key: fmt.Sprintf("entry%d", i), Value: []byte("paused value")}))
+	}
+
+	select {
+	case e := <-entries:
+		t.Fatalf("received entry %s while the source was paused", e.Key)
+	case <-time.After(5 * time.Second):
+	}
+
+	paused.Resume()
+	for i := 0; i < 3; i++ {
+		e := nextEntry(t, entries)
+		assert.EqualValues(t, fmt.Sprintf("%d-entry%d", i, i), e.Key)
+	}
+}
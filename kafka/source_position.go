@@ -0,0 +1,166 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errRewound ends a session after the source was rewound, so the partitions are read again from their new offsets.
+var errRewound = errors.New("the kafka source was rewound")
+
+// StartPosition overrides the offsets a partition is consumed from, instead of its committed offset.
+// The first option that is set wins: explicit Offsets, then Timestamp and then CommittedMinus.
+type StartPosition struct {
+	// Offsets holds explicit offsets per partition, partitions that aren't listed
+	// fall back to the other options.
+	Offsets map[TopicPartition]int64
+
+	// Timestamp starts every partition from the first message that was produced at or after it.
+	Timestamp time.Time
+
+	// CommittedMinus starts every partition this many messages before its committed offset,
+	// partitions without a committed offset start from SourceConfig.StartOffset.
+	CommittedMinus int64
+}
+
+// IsZero returns true if the position doesn't override anything.
+func (this StartPosition) IsZero() bool {
+	return len(this.Offsets) == 0 && this.Timestamp.IsZero() && this.CommittedMinus <= 0
+}
+
+// OffsetLookup returns the offset of the first message produced at or after the given time.
+type OffsetLookup func(tp TopicPartition, t time.Time) (int64, error)
+
+// resolve returns the offset the partition should be consumed from given its committed offset,
+// which may also be one of FirstOffset or LastOffset if nothing was committed yet.
+func (this StartPosition) resolve(tp TopicPartition, committed int64, lookup OffsetLookup) (int64, error) {
+	if offset, found := this.Offsets[tp]; found {
+		return offset, nil
+	}
+
+	if !this.Timestamp.IsZero() {
+		return lookup(tp, this.Timestamp)
+	}
+
+	if this.CommittedMinus > 0 && committed >= 0 {
+		// offsets before the first offset of the partition are skipped by the reader
+		if offset := committed - this.CommittedMinus; offset > 0 {
+			return offset, nil
+		}
+		return 0, nil
+	}
+
+	return committed, nil
+}
+
+// lookupOffset asks the partition's leader for the first offset produced at or after the given time.
+func (this *kafkaSource) lookupOffset(tp TopicPartition, t time.Time) (int64, error) {
+	conn, err := dialLeader(this.ctx, this.dialer, this.cfg.Hosts, tp)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return conn.ReadOffset(t)
+}
+
+// startOffset returns the offset a newly assigned partition should be read from, a pending
+// rewind wins over the configured StartPosition which is only applied the first time the
+// partition is assigned to this source.
+func (this *kafkaSource) startOffset(tp TopicPartition, committed int64) (int64, error) {
+	this.mutex.Lock()
+	rewound, isRewound := this.rewinds[tp]
+	delete(this.rewinds, tp)
+	positioned := this.positioned[tp]
+	this.positioned[tp] = true
+	this.mutex.Unlock()
+
+	if isRewound {
+		return rewound, nil
+	}
+	if positioned || this.cfg.StartPosition.IsZero() {
+		return committed, nil
+	}
+	return this.cfg.StartPosition.resolve(tp, committed, this.lookupOffset)
+}
+
+// Rewind moves the partitions that are currently assigned to this source to the given position,
+// when the source is part of a consumer group (or has an OffsetStore) the new offsets are committed as well.
+// The entries that were delivered before the rewind can no longer be committed.
+func (this *kafkaSource) Rewind(position StartPosition) error {
+	session := this.currentSession()
+	if session == nil {
+		return fmt.Errorf("the kafka source can't be rewound before it was started")
+	}
+
+	// the session will be re-created and its partitions will be read from the new offsets,
+	// even if the rewind fails the session is restarted from the committed offsets.
+	defer session.fail(errRewound)
+
+	offsets, err := session.rewind(position)
+	if err != nil {
+		return err
+	}
+
+	this.mutex.Lock()
+	for tp, offset := range offsets {
+		this.rewinds[tp] = offset
+	}
+	this.mutex.Unlock()
+	return nil
+}
+
+// rewind freezes the session, so nothing is delivered or committed anymore, and resolves the new offsets of
+// its assigned partitions, when the session belongs to a consumer group the new offsets are committed as well.
+func (this *sourceSession) rewind(position StartPosition) (map[TopicPartition]int64, error) {
+	this.mutex.Lock()
+	this.frozen = true
+	generation := this.generation
+	committed := make(map[TopicPartition]int64, len(this.assigned))
+	for tp := range this.assigned {
+		committed[tp] = this.committed[tp]
+	}
+	this.mutex.Unlock()
+
+	// entries that were acknowledged but not committed yet count as committed
+	for tp, progress := range this.source.offsets.Progress() {
+		if _, assigned := committed[tp]; assigned && progress.Watermark >= 0 {
+			committed[tp] = progress.Watermark
+		}
+	}
+	this.source.offsets.Reset()
+
+	offsets := make(map[TopicPartition]int64, len(committed))
+	request := make(map[string]map[int]int64)
+	for tp, offset := range committed {
+		resolved, err := position.resolve(tp, offset, this.source.lookupOffset)
+		if err != nil {
+			return nil, err
+		}
+		offsets[tp] = resolved
+
+		if resolved >= 0 {
+			if _, found := request[tp.Topic]; !found {
+				request[tp.Topic] = make(map[int]int64)
+			}
+			request[tp.Topic][tp.Partition] = resolved
+		}
+	}
+
+	if generation != nil && len(request) > 0 {
+		if err := generation.CommitOffsets(request); err != nil {
+			return nil, err
+		}
+	} else if store := this.source.cfg.OffsetStore; store != nil {
+		stored := make(map[TopicPartition]int64, len(offsets))
+		for tp, offset := range offsets {
+			if offset >= 0 {
+				stored[tp] = offset
+			}
+		}
+		if err := store.Save(stored); err != nil {
+			return nil, err
+		}
+	}
+	return offsets, nil
+}
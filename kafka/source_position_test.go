@@ -0,0 +1,61 @@
+package kafka
+
+import (
+	"fmt"
+	s "github.com/matang28/go-streams"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStartPosition_Resolve(t *testing.T) {
+	tp := TopicPartition{Topic: "t", Partition: 1}
+	lookup := func(tp TopicPartition, t time.Time) (int64, error) {
+		return 42, nil
+	}
+
+	offset, err := StartPosition{}.resolve(tp, 10, lookup)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 10, offset)
+
+	offset, err = StartPosition{Offsets: map[TopicPartition]int64{tp: 3}, Timestamp: time.Now()}.resolve(tp, 10, lookup)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, offset)
+
+	offset, err = StartPosition{Timestamp: time.Now(), CommittedMinus: 5}.resolve(tp, 10, lookup)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 42, offset)
+
+	offset, err = StartPosition{CommittedMinus: 5}.resolve(tp, 10, lookup)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 5, offset)
+
+	offset, err = StartPosition{CommittedMinus: 50}.resolve(tp, 10, lookup)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, offset)
+
+	offset, err = StartPosition{CommittedMinus: 5}.resolve(tp, -1, lookup)
+	assert.Nil(t, err)
+	assert.EqualValues(t, -1, offset)
+}
+
+func TestKafkaSource_Rewind(t *testing.T) {
+	producer := NewKafkaSink(NewSinkConfig([]string{"localhost:9092"}, "test_source_rewind"), nil)
+	for i := 0; i < 4; i++ {
+		panicOnErr(producer.Single(s.Entry{Key: fmt.Sprintf("entry%d", i), Value: []byte("rewind value")}))
+	}
+
+	tp := TopicPartition{Topic: "test_source_rewind", Partition: 0}
+	cfg := NewSourceConfig([]string{"localhost:9092"}, tp.Topic, "test_source_rewind_cg")
+	cfg.CommitIntervalMs = 0
+	cfg.StartPosition = StartPosition{Offsets: map[TopicPartition]int64{tp: 2}}
+	rewound, entries := startSource(t, cfg)
+	defer rewound.Stop()
+
+	e := nextEntry(t, entries)
+	assert.EqualValues(t, "2-entry2", e.Key)
+	assert.Nil(t, rewound.CommitEntry(e.Key, nextEntry(t, entries).Key))
+
+	assert.Nil(t, rewound.Rewind(StartPosition{CommittedMinus: 3}))
+	assert.EqualValues(t, "1-entry1", nextEntry(t, entries).Key)
+}
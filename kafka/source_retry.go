@@ -0,0 +1,197 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	k "github.com/segmentio/kafka-go"
+	"strconv"
+	"time"
+)
+
+// The headers a message carries in a retry topic, on top of its original headers.
+// The origin headers point at the message the entry was first retried from and are kept as it moves between tiers.
+const (
+	RetryTopicHeader     = "x-retry-topic"
+	RetryPartitionHeader = "x-retry-partition"
+	RetryOffsetHeader    = "x-retry-offset"
+	RetryErrorHeader     = "x-retry-error"
+
+	// RetryAttemptHeader holds the number of times the entry was retried so far.
+	RetryAttemptHeader = "x-retry-attempt"
+
+	// RetryNotBeforeHeader holds the time (in unix milliseconds) the entry should be emitted again at.
+	RetryNotBeforeHeader = "x-retry-not-before"
+)
+
+// ErrRetried is the error recorded for the entries that were retried by RetryEntry.
+var ErrRetried = fmt.Errorf("the entry was retried")
+
+// RetryTier is a retry topic, the entries written to it are emitted again by the retry source after its delay.
+type RetryTier struct {
+	Topic   string
+	DelayMs int
+}
+
+// NewKafkaRetrySource creates the companion of a source that was configured with RetryTiers, it consumes all the
+// retry topics and only emits an entry once its RetryNotBeforeHeader is due. Every tier has a single delay, so the
+// messages of a retry partition become due in the order they were written and waiting for the oldest one never
+// delays the others past their own due time.
+// The entries it emits can be committed, nacked or retried again (moving to the next tier) like any other entry.
+func NewKafkaRetrySource(cfg SourceConfig) *kafkaSource {
+	if len(cfg.RetryTiers) == 0 {
+		panic(fmt.Errorf("the kafka retry source requires at least one RetryTier"))
+	}
+
+	cfg.Topic = cfg.RetryTiers[0].Topic
+	cfg.Topics = nil
+	for _, tier := range cfg.RetryTiers[1:] {
+		cfg.Topics = append(cfg.Topics, tier.Topic)
+	}
+	cfg.TopicPattern = ""
+	if cfg.ConsumerGroup != "" {
+		cfg.ConsumerGroup += "-retry"
+	}
+
+	// every retried entry must be emitted again, even the ones written before the group was created
+	cfg.StartOffset = k.FirstOffset
+	cfg.StartPosition = StartPosition{}
+
+	out := NewKafkaSource(cfg)
+	out.delayed = true
+	return out
+}
+
+// RetryEntry writes the given entries to the retry tier matching their number of attempts and commits them,
+// entries that have exhausted all the tiers are written to the DeadLetterTopic instead (or fail the call
+// if the source doesn't have one). Unknown keys, or keys that were already acknowledged, are ignored.
+func (this *kafkaSource) RetryEntry(keys ...string) error {
+	return this.RetryEntryWithError(ErrRetried, keys...)
+}
+
+// RetryEntryWithError is like RetryEntry, the given error is recorded in the RetryErrorHeader.
+func (this *kafkaSource) RetryEntryWithError(cause error, keys ...string) error {
+	if len(this.retries) == 0 {
+		return fmt.Errorf("the kafka source can't retry entries without RetryTiers")
+	}
+	if !this.commitsOffsets() {
+		return fmt.Errorf("the kafka source can't retry entries without a ConsumerGroup or an OffsetStore")
+	}
+
+	tiers := make([][]k.Message, len(this.retries))
+	tierKeys := make([][]string, len(this.retries))
+	var exhausted []k.Message
+	var exhaustedKeys []string
+	for _, key := range keys {
+		m, found := this.offsets.Message(key)
+		if !found {
+			continue
+		}
+
+		attempt := retryAttempt(m)
+		if attempt >= len(this.retries) {
+			exhausted = append(exhausted, m)
+			exhaustedKeys = append(exhaustedKeys, key)
+			continue
+		}
+		tiers[attempt] = append(tiers[attempt], this.retried(cause, m, attempt))
+		tierKeys[attempt] = append(tierKeys[attempt], key)
+	}
+
+	// the entries that were written successfully are committed even if another tier failed
+	var out error
+	var routed []string
+	for idx, messages := range tiers {
+		if len(messages) == 0 {
+			continue
+		}
+		if err := this.retries[idx].WriteMessages(context.Background(), messages...); err != nil {
+			if out == nil {
+				out = fmt.Errorf("failed to write %d messages to the retry topic '%s': %s",
+					len(messages), this.cfg.RetryTiers[idx].Topic, err.Error())
+			}
+			continue
+		}
+		routed = append(routed, tierKeys[idx]...)
+	}
+
+	if len(exhausted) > 0 {
+		var err error
+		if this.deadLetters == nil {
+			err = fmt.Errorf("%d entries exhausted their %d retries and the kafka source doesn't have a DeadLetterTopic",
+				len(exhausted), len(this.retries))
+		} else {
+			err = this.writeDeadLetters(cause, exhausted...)
+		}
+
+		if err == nil {
+			routed = append(routed, exhaustedKeys...)
+		} else if out == nil {
+			out = err
+		}
+	}
+
+	if err := this.CommitEntry(routed...); err != nil && out == nil {
+		out = err
+	}
+	return out
+}
+
+// retried returns the copy of a message that is written to the given retry tier.
+func (this *kafkaSource) retried(cause error, m k.Message, attempt int) k.Message {
+	due := time.Now().Add(time.Duration(this.cfg.RetryTiers[attempt].DelayMs) * time.Millisecond)
+	headers := []k.Header{
+		{Key: RetryErrorHeader, Value: []byte(cause.Error())},
+		{Key: RetryAttemptHeader, Value: []byte(strconv.Itoa(attempt + 1))},
+		{Key: RetryNotBeforeHeader, Value: []byte(strconv.FormatInt(due.UnixNano()/int64(time.Millisecond), 10))},
+	}
+
+	// the first retry records where the entry came from
+	if attempt == 0 {
+		headers = append(headers,
+			k.Header{Key: RetryTopicHeader, Value: []byte(m.Topic)},
+			k.Header{Key: RetryPartitionHeader, Value: []byte(strconv.Itoa(m.Partition))},
+			k.Header{Key: RetryOffsetHeader, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		)
+	}
+	return forwarded(m, headers...)
+}
+
+// retryAttempt returns the number of times the message was retried, 0 if it was never retried.
+func retryAttempt(m k.Message) int {
+	attempt, err := strconv.Atoi(string(NewRecord(m).Header(RetryAttemptHeader)))
+	if err != nil || attempt < 0 {
+		return 0
+	}
+	return attempt
+}
+
+// retryDue returns the time the retried message should be emitted at, false if the message has no valid RetryNotBeforeHeader.
+func retryDue(m k.Message) (time.Time, bool) {
+	millis, err := strconv.ParseInt(string(NewRecord(m).Header(RetryNotBeforeHeader)), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)), true
+}
+
+// awaitDue blocks until the retried message is due, it returns false if the context was done before.
+func awaitDue(ctx context.Context, m k.Message) bool {
+	due, found := retryDue(m)
+	if !found {
+		return true
+	}
+
+	wait := time.Until(due)
+	if wait <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
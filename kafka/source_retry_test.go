@@ -0,0 +1,132 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRetry_Headers(t *testing.T) {
+	source := &kafkaSource{cfg: SourceConfig{RetryTiers: []RetryTier{
+		{Topic: "retry-1m", DelayMs: 60000},
+		{Topic: "retry-10m", DelayMs: 600000},
+	}}}
+	m := k.Message{Topic: "t", Partition: 1, Offset: 7, Value: []byte("value"), Headers: []k.Header{{Key: "h", Value: []byte("v")}}}
+
+	first := source.retried(ErrRetried, m, 0)
+	record := NewRecord(first)
+	assert.EqualValues(t, "value", record.Value)
+	assert.EqualValues(t, "v", record.Header("h"))
+	assert.EqualValues(t, "t", record.Header(RetryTopicHeader))
+	assert.EqualValues(t, "1", record.Header(RetryPartitionHeader))
+	assert.EqualValues(t, "7", record.Header(RetryOffsetHeader))
+	assert.EqualValues(t, ErrRetried.Error(), record.Header(RetryErrorHeader))
+	assert.EqualValues(t, 1, retryAttempt(first))
+
+	due, found := retryDue(first)
+	assert.True(t, found)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), due, 5*time.Second)
+
+	// the second tier replaces the retry headers and keeps the origin of the first retry
+	first.Topic, first.Partition, first.Offset = "retry-1m", 0, 3
+	second := source.retried(ErrRetried, first, 1)
+	record = NewRecord(second)
+	assert.Len(t, second.Headers, len(first.Headers))
+	assert.EqualValues(t, "t", record.Header(RetryTopicHeader))
+	assert.EqualValues(t, "7", record.Header(RetryOffsetHeader))
+	assert.EqualValues(t, 2, retryAttempt(second))
+
+	due, _ = retryDue(second)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), due, 5*time.Second)
+}
+
+func TestRetry_NeverRetried(t *testing.T) {
+	m := k.Message{Headers: []k.Header{{Key: RetryAttemptHeader, Value: []byte("garbage")}}}
+	assert.EqualValues(t, 0, retryAttempt(m))
+
+	_, found := retryDue(m)
+	assert.False(t, found)
+	assert.True(t, awaitDue(context.Background(), m))
+}
+
+func TestRetry_AwaitDue(t *testing.T) {
+	source := &kafkaSource{cfg: SourceConfig{RetryTiers: []RetryTier{{Topic: "retry", DelayMs: 200}}}}
+	m := source.retried(ErrRetried, k.Message{Topic: "t"}, 0)
+
+	start := time.Now()
+	assert.True(t, awaitDue(context.Background(), m))
+	assert.True(t, time.Since(start) >= 150*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, awaitDue(ctx, source.retried(ErrRetried, k.Message{Topic: "t"}, 0)))
+}
+
+func TestKafkaSource_RetryEntry(t *testing.T) {
+	producer := NewKafkaSink(NewSinkConfig([]string{"localhost:9092"}, "test_source_retry"), nil)
+	panicOnErr(producer.Single(s.Entry{Key: "entry0", Value: []byte("flaky")}))
+
+	cfg := NewSourceConfig([]string{"localhost:9092"}, "test_source_retry", "test_source_retry_cg")
+	cfg.StartOffset = k.FirstOffset
+	cfg.CommitIntervalMs = 0
+	cfg.DeadLetterTopic = "test_source_retry_dlq"
+	cfg.RetryTiers = []RetryTier{
+		{Topic: "test_source_retry_1s", DelayMs: 1000},
+		{Topic: "test_source_retry_2s", DelayMs: 2000},
+	}
+
+	source, entries := startSource(t, cfg)
+	defer source.Stop()
+
+	retrySource := NewKafkaRetrySource(cfg)
+	retried := make(s.EntryChannel, 10)
+	go retrySource.Start(retried, make(s.ErrorChannel, 100))
+	defer retrySource.Stop()
+
+	e := nextEntry(t, entries)
+	retriedAt := time.Now()
+	assert.Nil(t, source.RetryEntry(e.Key))
+	assert.EqualValues(t, 1, source.Progress()[TopicPartition{Topic: "test_source_retry", Partition: 0}].Committed)
+
+	// every tier emits the entry again only after its delay, then the entry goes to the dead letter topic
+	for _, delay := range []time.Duration{time.Second, 2 * time.Second} {
+		select {
+		case e = <-retried:
+			assert.EqualValues(t, "flaky", e.Value)
+			assert.True(t, time.Since(retriedAt) >= delay)
+		case <-time.After(60 * time.Second):
+			t.Fatal("timeout while waiting for the retried entry")
+		}
+		retriedAt = time.Now()
+		assert.Nil(t, retrySource.RetryEntry(e.Key))
+	}
+
+	letters := readTopic(cfg.DeadLetterTopic, 1)
+	record := NewRecord(letters[0])
+	assert.EqualValues(t, "flaky", record.Value)
+	assert.EqualValues(t, "test_source_retry_2s", record.Header(DeadLetterTopicHeader))
+	assert.EqualValues(t, "test_source_retry", record.Header(RetryTopicHeader))
+	assert.EqualValues(t, "2", record.Header(RetryAttemptHeader))
+}
+
+func TestKafkaSource_RetryEntry_AfterReconnect(t *testing.T) {
+	cfg := NewSourceConfig([]string{"localhost:9092"}, "test_source_retry_reconnect", "test_source_retry_reconnect_cg")
+	cfg.RetryTiers = []RetryTier{{Topic: "test_source_retry_reconnect_1s", DelayMs: 1000}}
+	cfg.ReconnectBackoffMinMs = 10
+	source := NewKafkaSource(cfg)
+	defer source.Stop()
+
+	// a reconnect only replaces the session, the retry writers must remain usable
+	assert.True(t, source.reconnect(fmt.Errorf("outage"), make(s.ErrorChannel, 100)))
+
+	m := k.Message{Topic: "test_source_retry_reconnect", Partition: 0, Offset: 0, Value: []byte("retried")}
+	source.offsets.Track(MessageKey(m), m)
+	assert.Nil(t, source.RetryEntry(MessageKey(m)))
+
+	retried := readWithin(t, cfg.RetryTiers[0].Topic, 1, 30*time.Second)
+	assert.EqualValues(t, 1, retryAttempt(retried[0]))
+}
@@ -0,0 +1,500 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"sort"
+	"sync"
+	"time"
+)
+
+// errTopicsChanged ends a session when the topics matching the source's TopicPattern have changed.
+var errTopicsChanged = errors.New("the topics matching the kafka source pattern have changed")
+
+// sourceSession holds everything that lives as long as a single connection of the kafka source:
+// the consumer group membership and one reader per assigned partition, all the readers push
+// their messages into the shared fetched channel.
+// A new session is created whenever the source (re)connects or when its topics change.
+type sourceSession struct {
+	source *kafkaSource
+	topics []string
+	errors s.ErrorChannel
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	fetched  chan k.Message
+	failures chan error
+
+	mutex      sync.Mutex
+	generation *k.Generation
+	assigned   map[TopicPartition]bool
+	committed  map[TopicPartition]int64
+	readers    map[TopicPartition]*k.Reader
+
+	// frozen is set once the source was rewound, nothing is delivered or committed
+	// anymore until the session is closed.
+	frozen bool
+
+	// revoked is set once the revoke hook was notified because the source is stopping,
+	// the hook isn't notified again when the partitions are actually released.
+	revoked bool
+}
+
+func newSourceSession(source *kafkaSource, topics []string, errorChannel s.ErrorChannel) *sourceSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	queueCapacity := source.cfg.QueueCapacity
+	if queueCapacity <= 0 {
+		queueCapacity = 100
+	}
+
+	return &sourceSession{
+		source:    source,
+		topics:    topics,
+		errors:    errorChannel,
+		ctx:       ctx,
+		cancel:    cancel,
+		fetched:   make(chan k.Message, queueCapacity),
+		failures:  make(chan error, 1),
+		assigned:  make(map[TopicPartition]bool),
+		committed: make(map[TopicPartition]int64),
+		readers:   make(map[TopicPartition]*k.Reader),
+	}
+}
+
+func (this *sourceSession) start() {
+	if len(this.topics) > 0 {
+		if this.source.cfg.ConsumerGroup != "" {
+			this.run(this.joinGroup)
+		} else {
+			this.run(this.readStaticPartitions)
+		}
+		if this.source.commitsOffsets() && this.source.cfg.CommitIntervalMs > 0 {
+			this.run(this.commitLoop)
+		}
+	}
+
+	if this.source.topicPattern != nil {
+		this.run(this.watchTopics)
+	}
+}
+
+// close ends the session, leaving the consumer group and closing all of the partition readers.
+func (this *sourceSession) close() {
+	this.cancel()
+	this.wg.Wait()
+}
+
+func (this *sourceSession) run(fn func()) {
+	this.wg.Add(1)
+	go func() {
+		defer this.wg.Done()
+		fn()
+	}()
+}
+
+// fail ends the session with the given error, only the first failure is kept.
+func (this *sourceSession) fail(err error) {
+	select {
+	case this.failures <- err:
+	default:
+	}
+}
+
+// owns returns true if the partition is currently assigned to this session.
+func (this *sourceSession) owns(tp TopicPartition) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.assigned[tp] && !this.frozen
+}
+
+// partitionReaders returns the readers of the partitions that are currently being read.
+func (this *sourceSession) partitionReaders() map[TopicPartition]*k.Reader {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	out := make(map[TopicPartition]*k.Reader, len(this.readers))
+	for tp, reader := range this.readers {
+		out[tp] = reader
+	}
+	return out
+}
+
+// commit commits the given watermarks of the partitions that are currently assigned to the session
+// and returns the watermarks that were actually committed.
+func (this *sourceSession) commit(offsets map[TopicPartition]int64) (map[TopicPartition]int64, error) {
+	this.mutex.Lock()
+	if this.frozen {
+		this.mutex.Unlock()
+		return nil, nil
+	}
+
+	generation := this.generation
+	committed := make(map[TopicPartition]int64, len(offsets))
+	request := make(map[string]map[int]int64)
+	for tp, offset := range offsets {
+		if !this.assigned[tp] {
+			continue
+		}
+		if _, found := request[tp.Topic]; !found {
+			request[tp.Topic] = make(map[int]int64)
+		}
+		request[tp.Topic][tp.Partition] = offset
+		committed[tp] = offset
+	}
+	this.mutex.Unlock()
+
+	store := this.source.cfg.OffsetStore
+	if (generation == nil && store == nil) || len(request) == 0 {
+		return nil, nil
+	}
+
+	if generation != nil {
+		if err := generation.CommitOffsets(request); err != nil {
+			return nil, err
+		}
+	} else if err := store.Save(committed); err != nil {
+		return nil, err
+	}
+
+	this.mutex.Lock()
+	for tp, offset := range committed {
+		this.committed[tp] = offset
+	}
+	this.mutex.Unlock()
+	return committed, nil
+}
+
+func (this *sourceSession) joinGroup() {
+	cfg := this.source.cfg
+	group, err := k.NewConsumerGroup(k.ConsumerGroupConfig{
+		ID:                     cfg.ConsumerGroup,
+		Brokers:                cfg.Hosts,
+		Dialer:                 this.source.dialer,
+		Topics:                 this.topics,
+		HeartbeatInterval:      time.Duration(cfg.HeartbeatIntervalSec) * time.Second,
+		PartitionWatchInterval: time.Duration(cfg.PartitionWatchIntervalSec) * time.Second,
+		WatchPartitionChanges:  cfg.WatchPartitionChanges,
+		SessionTimeout:         time.Duration(cfg.SessionTimeoutSec) * time.Second,
+		RebalanceTimeout:       time.Duration(cfg.RebalanceTimeoutSec) * time.Second,
+		JoinGroupBackoff:       time.Duration(cfg.JoinGroupBackoffSec) * time.Second,
+		StartOffset:            cfg.StartOffset,
+	})
+	if err != nil {
+		this.fail(err)
+		return
+	}
+	defer group.Close()
+
+	for {
+		generation, err := group.Next(this.ctx)
+		if err != nil {
+			if this.ctx.Err() != nil || err == k.ErrGroupClosed {
+				return
+			}
+			if ClassifyError(err) == RebalanceError {
+				reportError(this.ctx, this.errors, NewSourceError(err))
+				continue
+			}
+			this.fail(err)
+			return
+		}
+		this.assign(generation)
+	}
+}
+
+// assign starts a reader for every partition of the new generation, the previous generation has
+// already ended by now since the consumer group never returns two active generations.
+func (this *sourceSession) assign(generation *k.Generation) {
+	assigned := make(map[TopicPartition]bool)
+	committed := make(map[TopicPartition]int64)
+	for topic, partitions := range generation.Assignments {
+		for _, partition := range partitions {
+			tp := TopicPartition{Topic: topic, Partition: partition.ID}
+			assigned[tp] = true
+			committed[tp] = partition.Offset
+		}
+	}
+
+	// the new readers resume from the committed offsets, everything that was tracked
+	// before the rebalance will be fetched again.
+	this.source.offsets.Reset()
+
+	this.mutex.Lock()
+	this.generation = generation
+	this.assigned = assigned
+	this.committed = committed
+	this.mutex.Unlock()
+	s.Log().Info("Kafka source was assigned to %d partitions in generation %d", len(assigned), generation.ID)
+	this.notifyAssigned(assigned)
+
+	for topic, partitions := range generation.Assignments {
+		for _, partition := range partitions {
+			tp := TopicPartition{Topic: topic, Partition: partition.ID}
+			offset := partition.Offset
+			generation.Start(func(ctx context.Context) {
+				this.readPartition(ctx, tp, offset)
+			})
+		}
+	}
+
+	generation.Start(func(ctx context.Context) {
+		<-ctx.Done()
+		this.notifyRevoked(assigned)
+		if err := this.source.commitAcknowledged(); err != nil {
+			s.Log().Warn("Failed to commit kafka offsets at the end of generation %d: %s", generation.ID, err.Error())
+		}
+
+		this.mutex.Lock()
+		this.generation = nil
+		this.assigned = make(map[TopicPartition]bool)
+		this.mutex.Unlock()
+	})
+}
+
+func (this *sourceSession) notifyAssigned(partitions map[TopicPartition]bool) {
+	// the session got its partitions, a later failure is a new outage
+	this.source.resetReconnects()
+
+	if callback := this.source.cfg.OnPartitionsAssigned; callback != nil {
+		callback(sortedPartitions(partitions))
+	}
+}
+
+func (this *sourceSession) notifyRevoked(partitions map[TopicPartition]bool) {
+	this.mutex.Lock()
+	revoked := this.revoked
+	this.mutex.Unlock()
+	if revoked {
+		return
+	}
+
+	if callback := this.source.cfg.OnPartitionsRevoked; callback != nil {
+		callback(sortedPartitions(partitions))
+	}
+}
+
+// revokeAssigned notifies the revoke hook about the partitions that are currently assigned, once,
+// so a stopping source lets the caller flush and commit before it waits for the outstanding entries.
+func (this *sourceSession) revokeAssigned() {
+	this.mutex.Lock()
+	if this.revoked {
+		this.mutex.Unlock()
+		return
+	}
+	assigned := make(map[TopicPartition]bool, len(this.assigned))
+	for tp := range this.assigned {
+		assigned[tp] = true
+	}
+	this.revoked = true
+	this.mutex.Unlock()
+
+	if callback := this.source.cfg.OnPartitionsRevoked; callback != nil {
+		callback(sortedPartitions(assigned))
+	}
+}
+
+// readStaticPartitions reads the configured partitions of every topic when the source isn't part of a consumer group,
+// they start from the offsets in the source's OffsetStore if it has one.
+func (this *sourceSession) readStaticPartitions() {
+	partitions, err := this.source.staticPartitions(this.topics)
+	if err != nil {
+		this.fail(err)
+		return
+	}
+
+	committed, err := this.source.storedOffsets(partitions)
+	if err != nil {
+		this.fail(err)
+		return
+	}
+
+	assigned := make(map[TopicPartition]bool, len(partitions))
+	for _, tp := range partitions {
+		assigned[tp] = true
+	}
+
+	// like after a rebalance, the partitions are read again from their stored offsets
+	if this.source.cfg.OffsetStore != nil {
+		this.source.offsets.Reset()
+	}
+
+	this.mutex.Lock()
+	this.assigned = assigned
+	this.committed = committed
+	this.mutex.Unlock()
+	this.notifyAssigned(assigned)
+	defer this.notifyRevoked(assigned)
+
+	var wg sync.WaitGroup
+	for tp, offset := range committed {
+		wg.Add(1)
+		go func(tp TopicPartition, offset int64) {
+			defer wg.Done()
+			this.readPartition(this.ctx, tp, offset)
+		}(tp, offset)
+	}
+	wg.Wait()
+}
+
+// readPartition fetches the messages of a single partition until the source is stopped or the given
+// context is done, no message is pushed for as long as the partition is paused. Once the source was
+// stopped it keeps waiting for the context so the generation stays alive and the acknowledged entries
+// can still be committed.
+func (this *sourceSession) readPartition(lifetime context.Context, tp TopicPartition, committed int64) {
+	offset, err := this.source.startOffset(tp, committed)
+	if err != nil {
+		this.fail(err)
+		<-lifetime.Done()
+		return
+	}
+
+	cfg := this.source.cfg
+	reader := k.NewReader(k.ReaderConfig{
+		Brokers:         cfg.Hosts,
+		Dialer:          this.source.dialer,
+		Topic:           tp.Topic,
+		Partition:       tp.Partition,
+		QueueCapacity:   cfg.QueueCapacity,
+		MaxWait:         time.Duration(cfg.MaxWaitSeconds) * time.Second,
+		ReadLagInterval: time.Duration(cfg.ReadLagIntervalSec) * time.Second,
+		ReadBackoffMin:  time.Duration(cfg.ReadBackoffMinMs) * time.Millisecond,
+		ReadBackoffMax:  time.Duration(cfg.ReadBackoffMaxMs) * time.Millisecond,
+		MaxAttempts:     cfg.MaxAttempts,
+	})
+	defer reader.Close()
+
+	if err := reader.SetOffset(offset); err != nil {
+		this.fail(err)
+		<-lifetime.Done()
+		return
+	}
+
+	this.mutex.Lock()
+	this.readers[tp] = reader
+	this.mutex.Unlock()
+	defer func() {
+		// the counters of a closed reader still count towards the source's stats
+		this.source.fetches.collect(tp, reader.Stats())
+
+		this.mutex.Lock()
+		delete(this.readers, tp)
+		this.mutex.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(lifetime)
+	defer cancel()
+	go func() {
+		select {
+		case <-this.source.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+loop:
+	for {
+		m, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				this.fail(err)
+			}
+			break
+		}
+
+		// a retry source holds on to the message until it's due, and a paused
+		// partition holds on to it until it's resumed
+		if this.source.delayed && !awaitDue(ctx, m) {
+			break
+		}
+		if !this.source.awaitResumed(ctx, tp) {
+			break
+		}
+
+		select {
+		case this.fetched <- m:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	<-lifetime.Done()
+}
+
+// commitLoop commits the acknowledged offsets periodically when the source is configured with a CommitInterval.
+func (this *sourceSession) commitLoop() {
+	ticker := time.NewTicker(time.Duration(this.source.cfg.CommitIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-this.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := this.source.commitAcknowledged(); err != nil {
+				reportError(this.ctx, this.errors, NewSourceError(err))
+			}
+		}
+	}
+}
+
+// watchTopics re-evaluates the source's TopicPattern periodically and ends the session when
+// the matching topics have changed, so the source will subscribe to the new list of topics.
+func (this *sourceSession) watchTopics() {
+	interval := time.Duration(this.source.cfg.TopicRefreshIntervalSec) * time.Second
+	if interval <= 0 {
+		interval = defaultTopicRefreshInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-this.ctx.Done():
+			return
+		case <-ticker.C:
+			topics, err := this.source.resolveTopics()
+			if err != nil {
+				s.Log().Warn("Failed to refresh the kafka topics matching '%s': %s", this.source.cfg.TopicPattern, err.Error())
+				continue
+			}
+			if !sameTopics(topics, this.topics) {
+				s.Log().Info("Kafka topics matching '%s' have changed from %v to %v", this.source.cfg.TopicPattern, this.topics, topics)
+				this.fail(errTopicsChanged)
+				return
+			}
+		}
+	}
+}
+
+func sameTopics(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedPartitions(partitions map[TopicPartition]bool) []TopicPartition {
+	out := make([]TopicPartition, 0, len(partitions))
+	for tp := range partitions {
+		out = append(out, tp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Topic != out[j].Topic {
+			return out[i].Topic < out[j].Topic
+		}
+		return out[i].Partition < out[j].Partition
+	})
+	return out
+}
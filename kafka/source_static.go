@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"fmt"
+	k "github.com/segmentio/kafka-go"
+)
+
+// staticPartitions returns the partitions a source that isn't part of a consumer group reads: all the partitions
+// of its topics, the configured Partitions of every topic or only the first partition of every topic.
+func (this *kafkaSource) staticPartitions(topics []string) ([]TopicPartition, error) {
+	var out []TopicPartition
+	if !this.cfg.AllPartitions {
+		ids := this.cfg.Partitions
+		if len(ids) == 0 {
+			ids = []int{0}
+		}
+		for _, topic := range topics {
+			for _, id := range ids {
+				out = append(out, TopicPartition{Topic: topic, Partition: id})
+			}
+		}
+		return out, nil
+	}
+
+	conn, err := dialAny(this.dialer, this.cfg.Hosts)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	partitions, err := conn.ReadPartitions(topics...)
+	if err != nil {
+		return nil, err
+	}
+	unique := make(map[TopicPartition]bool, len(partitions))
+	for _, partition := range partitions {
+		unique[TopicPartition{Topic: partition.Topic, Partition: partition.ID}] = true
+	}
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("kafka topics %v have no partitions", topics)
+	}
+	return sortedPartitions(unique), nil
+}
+
+// storedOffsets returns the offsets the given partitions should be read from, without an OffsetStore every
+// partition is read from its first offset, otherwise the partitions that don't have a stored offset yet
+// start from the configured StartOffset like they would in a consumer group.
+func (this *kafkaSource) storedOffsets(partitions []TopicPartition) (map[TopicPartition]int64, error) {
+	out := make(map[TopicPartition]int64, len(partitions))
+	store := this.cfg.OffsetStore
+	if store == nil {
+		for _, tp := range partitions {
+			out[tp] = k.FirstOffset
+		}
+		return out, nil
+	}
+
+	stored, err := store.Load(partitions)
+	if err != nil {
+		return nil, err
+	}
+	for _, tp := range partitions {
+		if offset, found := stored[tp]; found {
+			out[tp] = offset
+		} else {
+			out[tp] = this.cfg.StartOffset
+		}
+	}
+	return out, nil
+}
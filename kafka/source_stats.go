@@ -0,0 +1,250 @@
+package kafka
+
+import (
+	k "github.com/segmentio/kafka-go"
+	"sync"
+	"time"
+)
+
+const defaultStatsInterval = time.Minute
+
+// SourceStats is a snapshot of the kafka source's metrics. The counters returned by Stats are cumulative
+// since the source was created, the StatsCallback receives the counters and rates of the period since its
+// previous call instead.
+type SourceStats struct {
+	// Period covered by the counters of this snapshot.
+	Period time.Duration
+
+	// Total lag of all the assigned partitions.
+	Lag int64
+
+	// Messages and bytes fetched during the period, across all the partitions.
+	Messages int64
+	Bytes    int64
+
+	// Messages and bytes fetched per second during the period.
+	MessageRate float64
+	ByteRate    float64
+
+	// Latency of the offset commits made during the period.
+	Commits          int64
+	CommitLatencyAvg time.Duration
+	CommitLatencyMax time.Duration
+
+	// Number of delivered entries that weren't committed yet.
+	Uncommitted int
+
+	Partitions map[TopicPartition]PartitionStats
+}
+
+// PartitionStats holds the metrics of a single assigned partition.
+type PartitionStats struct {
+	// The offset of the next message to fetch.
+	Offset int64
+
+	// The number of messages between Offset and the end of the partition,
+	// refreshed every ReadLagInterval.
+	Lag int64
+
+	Messages int64
+	Bytes    int64
+
+	// Number of delivered entries of this partition that weren't committed yet.
+	Uncommitted int
+}
+
+// since returns the counters of this snapshot minus the ones of an earlier snapshot, the gauges
+// (lag, offsets and uncommitted entries) are kept as they are.
+func (this SourceStats) since(earlier SourceStats) SourceStats {
+	out := this
+	out.Period -= earlier.Period
+	out.Messages -= earlier.Messages
+	out.Bytes -= earlier.Bytes
+	out.Partitions = make(map[TopicPartition]PartitionStats, len(this.Partitions))
+	for tp, partition := range this.Partitions {
+		partition.Messages -= earlier.Partitions[tp].Messages
+		partition.Bytes -= earlier.Partitions[tp].Bytes
+		out.Partitions[tp] = partition
+	}
+	out.setRates()
+	return out
+}
+
+func (this *SourceStats) setRates() {
+	this.MessageRate, this.ByteRate = 0, 0
+	if seconds := this.Period.Seconds(); seconds > 0 {
+		this.MessageRate = float64(this.Messages) / seconds
+		this.ByteRate = float64(this.Bytes) / seconds
+	}
+}
+
+func newCommitStats() *commitStats {
+	return &commitStats{created: time.Now()}
+}
+
+// commitStats keeps the commit latencies since the source was created, and since the
+// previous period for the StatsCallback.
+type commitStats struct {
+	mutex   sync.Mutex
+	created time.Time
+	total   latencies
+	current latencies
+}
+
+type latencies struct {
+	count int64
+	sum   time.Duration
+	max   time.Duration
+}
+
+func (this *latencies) observe(latency time.Duration) {
+	this.count++
+	this.sum += latency
+	if latency > this.max {
+		this.max = latency
+	}
+}
+
+func (this latencies) avg() time.Duration {
+	if this.count == 0 {
+		return 0
+	}
+	return this.sum / time.Duration(this.count)
+}
+
+func (this *commitStats) observe(latency time.Duration) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.total.observe(latency)
+	this.current.observe(latency)
+}
+
+// cumulative returns the commit metrics since the source was created.
+func (this *commitStats) cumulative() (period time.Duration, count int64, avg time.Duration, max time.Duration) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return time.Since(this.created), this.total.count, this.total.avg(), this.total.max
+}
+
+// period returns the commit metrics since the previous call and starts a new period,
+// only the StatsCallback's reports should call it.
+func (this *commitStats) period() (count int64, avg time.Duration, max time.Duration) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	current := this.current
+	this.current = latencies{}
+	return current.count, current.avg(), current.max
+}
+
+// fetchStats accumulates the counters of the partition readers, a reader resets its counters whenever its
+// stats are read, so they're added here every time (including once the reader is closed) to never be lost.
+type fetchStats struct {
+	mutex      sync.Mutex
+	partitions map[TopicPartition]PartitionStats
+}
+
+func newFetchStats() *fetchStats {
+	return &fetchStats{partitions: make(map[TopicPartition]PartitionStats)}
+}
+
+func (this *fetchStats) collect(tp TopicPartition, stats k.ReaderStats) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	partition := this.partitions[tp]
+	partition.Messages += stats.Messages
+	partition.Bytes += stats.Bytes
+	this.partitions[tp] = partition
+}
+
+func (this *fetchStats) snapshot() map[TopicPartition]PartitionStats {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	out := make(map[TopicPartition]PartitionStats, len(this.partitions))
+	for tp, partition := range this.partitions {
+		out[tp] = partition
+	}
+	return out
+}
+
+// Stats returns a snapshot of the source's metrics, its counters are cumulative since the source was
+// created so reading them doesn't affect the periods reported to the StatsCallback.
+func (this *kafkaSource) Stats() SourceStats {
+	period, commits, avg, max := this.commits.cumulative()
+	out := SourceStats{
+		Period:           period,
+		Commits:          commits,
+		CommitLatencyAvg: avg,
+		CommitLatencyMax: max,
+		Partitions:       make(map[TopicPartition]PartitionStats),
+	}
+
+	readers := make(map[TopicPartition]k.ReaderStats)
+	if session := this.currentSession(); session != nil {
+		for tp, reader := range session.partitionReaders() {
+			stats := reader.Stats()
+			this.fetches.collect(tp, stats)
+			readers[tp] = stats
+		}
+	}
+
+	fetched := this.fetches.snapshot()
+	for _, partition := range fetched {
+		out.Messages += partition.Messages
+		out.Bytes += partition.Bytes
+	}
+
+	progress := this.offsets.Progress()
+	for tp, stats := range readers {
+		out.Partitions[tp] = PartitionStats{
+			Offset:      stats.Offset,
+			Lag:         stats.Lag,
+			Messages:    fetched[tp].Messages,
+			Bytes:       fetched[tp].Bytes,
+			Uncommitted: progress[tp].Pending + progress[tp].Acked,
+		}
+		out.Lag += stats.Lag
+	}
+
+	for _, partition := range progress {
+		out.Uncommitted += partition.Pending + partition.Acked
+	}
+
+	out.setRates()
+	return out
+}
+
+// Lag returns the current lag of every assigned partition.
+func (this *kafkaSource) Lag() map[TopicPartition]int64 {
+	out := make(map[TopicPartition]int64)
+	if session := this.currentSession(); session != nil {
+		for tp, reader := range session.partitionReaders() {
+			out[tp] = reader.Lag()
+		}
+	}
+	return out
+}
+
+// reportStats calls the configured StatsCallback periodically until the source is stopped.
+func (this *kafkaSource) reportStats() {
+	interval := time.Duration(this.cfg.StatsIntervalSec) * time.Second
+	if interval <= 0 {
+		interval = defaultStatsInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// the first period starts when the source was created
+	var previous SourceStats
+	for {
+		select {
+		case <-this.ctx.Done():
+			return
+		case <-ticker.C:
+			current := this.Stats()
+			report := current.since(previous)
+			report.Commits, report.CommitLatencyAvg, report.CommitLatencyMax = this.commits.period()
+			this.cfg.StatsCallback(report)
+			previous = current
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package kafka
+
+import (
+	"fmt"
+	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCommitStats_Periods(t *testing.T) {
+	stats := newCommitStats()
+	stats.observe(10 * time.Millisecond)
+	stats.observe(30 * time.Millisecond)
+
+	count, avg, max := stats.period()
+	assert.EqualValues(t, 2, count)
+	assert.EqualValues(t, 20*time.Millisecond, avg)
+	assert.EqualValues(t, 30*time.Millisecond, max)
+
+	stats.observe(5 * time.Millisecond)
+	count, avg, max = stats.period()
+	assert.EqualValues(t, 1, count)
+	assert.EqualValues(t, 5*time.Millisecond, avg)
+	assert.EqualValues(t, 5*time.Millisecond, max)
+
+	// the cumulative metrics aren't affected by the periods
+	period, count, avg, max := stats.cumulative()
+	assert.True(t, period > 0)
+	assert.EqualValues(t, 3, count)
+	assert.EqualValues(t, 15*time.Millisecond, avg)
+	assert.EqualValues(t, 30*time.Millisecond, max)
+}
+
+func TestCommitStats_Since(t *testing.T) {
+	tp := TopicPartition{Topic: "t", Partition: 0}
+	fetches := newFetchStats()
+	fetches.collect(tp, k.ReaderStats{Messages: 4, Bytes: 40})
+	earlier := SourceStats{Period: time.Second, Messages: 4, Bytes: 40, Partitions: fetches.snapshot()}
+
+	// a reader that was closed in between still counts
+	fetches.collect(tp, k.ReaderStats{Messages: 6, Bytes: 60})
+	later := SourceStats{Period: 3 * time.Second, Messages: 10, Bytes: 100, Lag: 7, Partitions: fetches.snapshot()}
+
+	period := later.since(earlier)
+	assert.EqualValues(t, 2*time.Second, period.Period)
+	assert.EqualValues(t, 6, period.Messages)
+	assert.EqualValues(t, 60, period.Bytes)
+	assert.EqualValues(t, 3, period.MessageRate)
+	assert.EqualValues(t, 7, period.Lag)
+	assert.EqualValues(t, 6, period.Partitions[tp].Messages)
+	assert.EqualValues(t, 10, later.Partitions[tp].Messages)
+}
+
+func TestKafkaSource_Stats(t *testing.T) {
+	producer := NewKafkaSink(NewSinkConfig([]string{"localhost:9092"}, "test_source_stats"), nil)
+	for i := 0; i < 2; i++ {
+		panicOnErr(producer.Single(s.Entry{Key: fmt.Sprintf("entry%d", i), Value: []byte("stats value")}))
+	}
+
+	cfg := NewSourceConfig([]string{"localhost:9092"}, "test_source_stats", "test_source_stats_cg")
+	cfg.StartOffset = k.FirstOffset
+	cfg.CommitIntervalMs = 0
+	reported := make(chan SourceStats, 10)
+	cfg.StatsIntervalSec = 1
+	cfg.StatsCallback = func(stats SourceStats) {
+		reported <- stats
+	}
+	measured, entries := startSource(t, cfg)
+	defer measured.Stop()
+
+	var keys []string
+	for i := 0; i < 2; i++ {
+		e := nextEntry(t, entries)
+		keys = append(keys, e.Key)
+	}
+
+	stats := measured.Stats()
+	tp := TopicPartition{Topic: "test_source_stats", Partition: 0}
+	assert.EqualValues(t, 2, stats.Uncommitted)
+	assert.EqualValues(t, 2, stats.Partitions[tp].Uncommitted)
+	assert.Contains(t, measured.Lag(), tp)
+
+	assert.Nil(t, measured.CommitEntry(keys...))
+	stats = measured.Stats()
+	assert.EqualValues(t, 0, stats.Uncommitted)
+	assert.EqualValues(t, 1, stats.Commits)
+	assert.EqualValues(t, 2, stats.Messages)
+
+	// reading the stats doesn't take anything away from the periodic reports
+	var messages int64
+	var commits int64
+	deadline := time.After(5 * time.Second)
+	for messages < 2 || commits < 1 {
+		select {
+		case report := <-reported:
+			messages += report.Messages
+			commits += report.Commits
+		case <-deadline:
+			t.Fatal("the stats callback didn't report the fetched messages and the commit")
+		}
+	}
+	assert.EqualValues(t, 2, measured.Stats().Messages)
+}
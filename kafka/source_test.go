@@ -1,22 +1,25 @@
 package kafka
 
 import (
+	"fmt"
 	s "github.com/matang28/go-streams"
+	k "github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestKafkaSource_Start(t *testing.T) {
 	entry1 := s.Entry{
-		Key:   "0-entry1",
+		Key:   "entry1",
 		Value: []byte("entry value 1"),
 	}
 	entry2 := s.Entry{
-		Key:   "1-entry2",
+		Key:   "entry2",
 		Value: []byte("entry value 2"),
 	}
 	entry3 := s.Entry{
-		Key:   "2-entry3",
+		Key:   "entry3",
 		Value: []byte("entry value 3"),
 	}
 
@@ -34,12 +37,148 @@ func TestKafkaSource_Start(t *testing.T) {
 
 	assert.EqualValues(t, 3, len(actual))
 
-	assert.EqualValues(t, entry1.Key, actual[0].Key)
+	assert.EqualValues(t, "0-entry1", actual[0].Key)
 	assert.EqualValues(t, entry1.Value, actual[0].Value)
 
-	assert.EqualValues(t, entry2.Key, actual[1].Key)
+	assert.EqualValues(t, "1-entry2", actual[1].Key)
 	assert.EqualValues(t, entry2.Value, actual[1].Value)
 
-	assert.EqualValues(t, entry3.Key, actual[2].Key)
+	assert.EqualValues(t, "2-entry3", actual[2].Key)
 	assert.EqualValues(t, entry3.Value, actual[2].Value)
 }
+
+func TestKafkaSource_Stop(t *testing.T) {
+	cfg := NewSourceConfig([]string{"localhost:9092"}, "test_source_stop", "test_source_stop_cg")
+	cfg.ShutdownTimeoutSec = 2
+	stopped := NewKafkaSource(cfg)
+
+	entries := make(s.EntryChannel)
+	errors := make(s.ErrorChannel, 1)
+	go stopped.Start(entries, errors)
+
+	done := make(chan error)
+	go func() {
+		time.Sleep(time.Second)
+		done <- stopped.Stop()
+	}()
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("kafka source did not stop in time")
+	}
+
+	_, ok := <-entries
+	assert.False(t, ok)
+}
+
+func TestKafkaSource_StopWhileConnecting(t *testing.T) {
+	stopped := NewKafkaSource(NewSourceConfig([]string{"localhost:9092"}, "test_source_stop", "test_source_stop_cg"))
+	assert.Nil(t, stopped.Stop())
+
+	// a source that was stopped while it was connecting doesn't open a session nobody would close
+	assert.Nil(t, stopped.consume(make(s.EntryChannel), make(s.ErrorChannel, 100)))
+	assert.Nil(t, stopped.currentSession())
+}
+
+func TestKafkaSource_MultipleTopics(t *testing.T) {
+	for _, topic := range []string{"test_multi_a", "test_multi_b"} {
+		producer := NewKafkaSink(NewSinkConfig([]string{"localhost:9092"}, topic), nil)
+		panicOnErr(producer.Single(s.Entry{Key: topic, Value: []byte(topic)}))
+	}
+
+	cfg := NewSourceConfig([]string{"localhost:9092"}, "", "test_multi_cg")
+	cfg.Topics = []string{"test_multi_a"}
+	cfg.TopicPattern = "^test_multi_b$"
+	cfg.TopicRefreshIntervalSec = 1
+	cfg.StartOffset = k.FirstOffset
+	cfg.ValueExtractor = MessageEntryFunc
+	multi, entries := startSource(t, cfg)
+	defer multi.Stop()
+
+	topics := make(map[string]int)
+	for i := 0; i < 2; i++ {
+		e := nextEntry(t, entries)
+		m := e.Value.(k.Message)
+		assert.EqualValues(t, m.Topic, string(m.Value))
+		assert.EqualValues(t, 0, m.Partition)
+		topics[m.Topic]++
+		assert.Nil(t, multi.CommitEntry(e.Key))
+	}
+
+	assert.EqualValues(t, map[string]int{"test_multi_a": 1, "test_multi_b": 1}, topics)
+}
+
+func TestKafkaSource_BatchMode(t *testing.T) {
+	producer := NewKafkaSink(NewSinkConfig([]string{"localhost:9092"}, "test_source_batch"), nil)
+	for i := 0; i < 5; i++ {
+		panicOnErr(producer.Single(s.Entry{Key: fmt.Sprintf("entry%d", i), Value: []byte("batch value")}))
+	}
+
+	cfg := NewSourceConfig([]string{"localhost:9092"}, "test_source_batch", "test_source_batch_cg")
+	cfg.StartOffset = k.FirstOffset
+	cfg.BatchMaxMessages = 3
+	cfg.BatchMaxLingerMs = 200
+	cfg.CommitIntervalMs = 0
+	batched, entries := startSource(t, cfg)
+	defer batched.Stop()
+
+	var keys []string
+	for i := 0; i < 5; i++ {
+		e := nextEntry(t, entries)
+		keys = append(keys, e.Key)
+	}
+
+	for i := range keys {
+		assert.EqualValues(t, fmt.Sprintf("%d-entry%d", i, i), keys[i])
+	}
+	assert.Nil(t, batched.CommitEntry(keys...))
+	assert.EqualValues(t, 5, batched.Progress()[TopicPartition{Topic: "test_source_batch"}].Committed)
+}
+
+func TestKafkaSource_RebalanceHooks(t *testing.T) {
+	producer := NewKafkaSink(NewSinkConfig([]string{"localhost:9092"}, "test_source_hooks"), nil)
+	panicOnErr(producer.Single(s.Entry{Key: "entry0", Value: []byte("hooks value")}))
+
+	var hooked *kafkaSource
+	var processed []string
+	assigned := make(chan []TopicPartition, 10)
+	revoked := make(chan []TopicPartition, 10)
+
+	cfg := NewSourceConfig([]string{"localhost:9092"}, "test_source_hooks", "test_source_hooks_cg")
+	cfg.StartOffset = k.FirstOffset
+	cfg.CommitIntervalMs = 0
+	cfg.ShutdownTimeoutSec = 1
+	cfg.OnPartitionsAssigned = func(partitions []TopicPartition) {
+		assigned <- partitions
+	}
+	cfg.OnPartitionsRevoked = func(partitions []TopicPartition) {
+		// flush whatever was processed before the partitions move
+		assert.Nil(t, hooked.CommitEntry(processed...))
+		revoked <- partitions
+	}
+	hooked, entries := startSource(t, cfg)
+
+	expected := []TopicPartition{{Topic: "test_source_hooks", Partition: 0}}
+	select {
+	case partitions := <-assigned:
+		assert.EqualValues(t, expected, partitions)
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout while waiting for the partitions to be assigned")
+	}
+
+	e := nextEntry(t, entries)
+	processed = append(processed, e.Key)
+
+	// the entry is only committed by the revoke hook, which runs before Stop waits for the outstanding entries
+	assert.Nil(t, hooked.Stop())
+
+	select {
+	case partitions := <-revoked:
+		assert.EqualValues(t, expected, partitions)
+	default:
+		t.Fatal("the partitions were not revoked when the source was stopped")
+	}
+	assert.EqualValues(t, 1, hooked.Progress()[expected[0]].Committed)
+}